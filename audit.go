@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+)
+
+// databases that come with MariaDB
+var systemDatabases = map[string]bool{
+	"information_schema": true,
+	"mysql":              true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+// names createSite gives databases, site names with dashes made underscores
+var siteDatabaseRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_]*$`)
+
+// AuditFinding is a mismatch between sites, containers and the database
+// server. Findings with a fix can be cleaned up by audit.
+type AuditFinding struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+
+	fixTitle string
+	fix      func() error
+	// --fix only selects fixes that can't hit something boost didn't make
+	unsafe bool
+}
+
+// AuditSites cross-references site folders, compose containers, databases
+// and database users.
+func AuditSites(backupsDir string) ([]AuditFinding, error) {
+	sitesDir := "/home/" + USER + "/sites"
+	sites := GetDirectoriesInPath(sitesDir)
+	isSite := make(map[string]bool)
+	for _, site := range sites {
+		isSite[site] = true
+	}
+
+	containers, err := ListComposeContainers()
+	if err != nil {
+		return nil, err
+	}
+	databases, err := mariadbSelect("List databases", "mysql", "SHOW DATABASES")
+	if err != nil {
+		return nil, err
+	}
+	users, err := ListDatabaseUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []AuditFinding
+
+	// sites without containers
+	hasContainers := make(map[string]bool)
+	for _, container := range containers {
+		hasContainers[container.Site()] = true
+	}
+	for _, site := range sites {
+		if !hasContainers[site] {
+			findings = append(findings, AuditFinding{
+				Kind:   "site without containers",
+				Name:   site,
+				Detail: "run boost start " + site + " to create them, or boost delete " + site,
+			})
+		}
+	}
+
+	// containers without a site, or without a compose file at all
+	for _, container := range containers {
+		var detail string
+		site := container.Site()
+		switch {
+		case container.Project == "":
+			detail = "not created by docker compose"
+		case site != "" && !isSite[site]:
+			detail = "site " + site + " no longer exists"
+		default:
+			continue
+		}
+		name := container.Name
+		findings = append(findings, AuditFinding{
+			Kind:     "container without site",
+			Name:     name,
+			Detail:   detail + " (" + container.State + ")",
+			fixTitle: "Remove container " + name,
+			fix: func() error {
+				_, err := command("docker", "rm", "-f", name).Step("Remove container " + name)
+				return err
+			},
+			unsafe: container.Project == "",
+		})
+	}
+
+	// databases without a site, kept as a dump before dropping. If a site's
+	// wp-config.php can't be read, any of them might be its database.
+	siteDatabases := make(map[string]bool)
+	var unreadable []string
+	for _, site := range sites {
+		siteDatabases[ReplaceDashWithUnderscore(site)] = true
+		values, err := ReadDefineValues(sitePath(site) + "/wordpress/wp-config.php")
+		switch {
+		case err == nil:
+			siteDatabases[values["DB_NAME"]] = true
+		case !errors.Is(err, fs.ErrNotExist):
+			// wp-config.php doesn't exist until WordPress is installed
+			unreadable = append(unreadable, site)
+			findings = append(findings, AuditFinding{
+				Kind:   "unreadable wp-config.php",
+				Name:   site,
+				Detail: err.Error(),
+			})
+		}
+	}
+	for _, row := range databases {
+		db := row[0]
+		if systemDatabases[db] || siteDatabases[db] {
+			continue
+		}
+		if len(unreadable) > 0 {
+			findings = append(findings, AuditFinding{
+				Kind:   "database without site",
+				Name:   db,
+				Detail: "not dropped, it may belong to " + strings.Join(unreadable, ", "),
+			})
+			continue
+		}
+		dump := filepath.Join(backupsDir, "_orphaned", "db-"+db+"-"+time.Now().Format(backupTimeLayout)+".sql.gz")
+		findings = append(findings, AuditFinding{
+			Kind:     "database without site",
+			Name:     db,
+			Detail:   "no site uses it",
+			fixTitle: "Drop database " + db + " (dumped to " + dump + " first)",
+			fix: func() error {
+				if err := DumpDatabase(db, dump); err != nil {
+					return stepFailed("Dump database "+db, err)
+				}
+				_, err := mariadbQuery("DROP DATABASE IF EXISTS $DB_NAME;", "DB_NAME="+db).Step("Drop database " + db)
+				return err
+			},
+			// createSite names databases after the site
+			unsafe: !siteDatabaseRe.MatchString(db),
+		})
+	}
+
+	// database users made for sites that are gone
+	for _, user := range users {
+		if !user.Orphaned() {
+			continue
+		}
+		findings = append(findings, AuditFinding{
+			Kind:     "user without site",
+			Name:     user.User + "@" + user.Host,
+			Detail:   "no site uses it",
+			fixTitle: "Drop user " + user.User + "@" + user.Host,
+			fix: func() error {
+				_, err := mariadbQuery("DROP USER IF EXISTS '$DB_USER'@'$DB_USER_HOST';", "DB_USER="+user.User, "DB_USER_HOST="+user.Host).Step("Drop database user " + user.User)
+				return err
+			},
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Kind < findings[j].Kind
+	})
+	return findings, nil
+}
+
+var auditArgs struct {
+	json bool
+	fix  bool
+}
+
+func auditFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&auditArgs.json, "json", false, "print findings as JSON")
+	fs.BoolVar(&auditArgs.fix, "fix", false, "clean up everything that can be cleaned up, except containers not created by docker compose and databases not named like a site")
+}
+
+func audit() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+
+	var findings []AuditFinding
+	err = spin("Auditing sites...", func() error {
+		var err error
+		findings, err = AuditSites(config.BackupsDir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if auditArgs.json {
+		return printJSON(findings)
+	}
+	if len(findings) == 0 {
+		printInBox("Sites, containers and databases all match up. Have a harmonious day!")
+		return nil
+	}
+
+	rows := make([][]string, 0, len(findings))
+	var fixable []huh.Option[int]
+	var selected []int
+	for i, finding := range findings {
+		rows = append(rows, []string{finding.Kind, finding.Name, finding.Detail})
+		if finding.fix != nil {
+			fixable = append(fixable, huh.NewOption(finding.fixTitle, i))
+			if auditArgs.fix && !finding.unsafe {
+				selected = append(selected, i)
+			}
+		}
+	}
+	fmt.Println(renderTable([]string{"Problem", "Name", "Detail"}, rows))
+
+	if len(fixable) == 0 || (scripted && !auditArgs.fix) {
+		return nil
+	}
+
+	err = prompt(huh.NewMultiSelect[int]().
+		Title("Clean up").
+		Description("Nothing is selected by default.").
+		Options(fixable...).
+		Value(&selected))
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	titles := make([]string, 0, len(selected))
+	for _, i := range selected {
+		titles = append(titles, findings[i].fixTitle)
+	}
+	confirmed := false
+	confirm(fmt.Sprintf("Run %d cleanups?", len(selected)), strings.Join(titles, "\n"), &confirmed)
+	if !confirmed {
+		return declined()
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+	for _, i := range selected {
+		if err := spin(findings[i].fixTitle+"...", findings[i].fix); err != nil {
+			return err
+		}
+		fmt.Println("✓ " + findings[i].fixTitle)
+	}
+
+	printInBox("Cleaned up. Have a tidy day!")
+	return nil
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+)
+
+// layout of the timestamp in backup file names
+const backupTimeLayout = "20060102-150405"
+
+// BackupFile is a backup written for a site.
+type BackupFile struct {
+	Site    string
+	Kind    string // "db" or "site"
+	Path    string
+	Size    int64
+	Created time.Time
+	// why a site archive has no database, empty when it has one
+	DatabaseSkipped string
+}
+
+// backupFileName returns a name like db-20240301-120000.sql.gz
+func backupFileName(kind, ext string, t time.Time) string {
+	return kind + "-" + t.Format(backupTimeLayout) + ext
+}
+
+// SiteDatabase returns the database name a site uses according to its
+// wp-config.php.
+func SiteDatabase(site string) (string, error) {
+	values, err := ReadDefineValues(sitePath(site) + "/wordpress/wp-config.php")
+	if err != nil {
+		return "", err
+	}
+	dbName, reason := localDatabase(values)
+	if dbName == "" {
+		return "", errors.New(reason)
+	}
+	return dbName, nil
+}
+
+// localDatabase returns the database in the mariadb container that the
+// values of a wp-config.php point at, or the reason there is none.
+func localDatabase(values map[string]string) (dbName, reason string) {
+	if values["DB_NAME"] == "" {
+		return "", "DB_NAME not found in wp-config.php"
+	}
+	if host := values["DB_HOST"]; host != "" && host != "mariadb" && !strings.HasPrefix(host, "mariadb:") {
+		return "", fmt.Sprintf("database is on %s, not the mariadb container", host)
+	}
+	return values["DB_NAME"], ""
+}
+
+// dumpCommand streams a database dump to stdout
+func dumpCommand(dbName string) *Cmd {
+	return command("docker", "exec", "-e", "DB_NAME="+dbName, "mariadb", "sh", "-c", "\"$(command -v mariadb-dump || echo mysqldump)\" -uroot -p\"$MYSQL_ROOT_PASSWORD\" --single-transaction --routines --triggers --add-drop-table \"$DB_NAME\"")
+}
+
+// DumpDatabase writes a gzip compressed dump of dbName to target.
+func DumpDatabase(dbName, target string) error {
+	return writeDump(dumpCommand(dbName), "Dump database "+dbName, target)
+}
+
+// writeDump gzips the output of a dump command into target. The dump goes
+// to a temporary file first so a failed dump never looks like a backup.
+func writeDump(cmd *Cmd, step, target string) error {
+	return do(cmd.String()+" | gzip > "+target, func() error {
+		if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return err
+		}
+		out, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(out.Name())
+		defer out.Close()
+
+		var stderr bytes.Buffer
+		gz := gzip.NewWriter(out)
+		cmd.Stdout = gz
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return cmd.stepError(step, stderr.Bytes(), err)
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		if err := out.Chmod(0640); err != nil {
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Rename(out.Name(), target)
+	})
+}
+
+// BackupDatabase dumps a site's database into its backup folder.
+func BackupDatabase(site, backupsDir string) (BackupFile, error) {
+	dbName, err := SiteDatabase(site)
+	if err != nil {
+		return BackupFile{}, stepFailed("Find database for "+site, err)
+	}
+	created := time.Now()
+	target := filepath.Join(backupsDir, site, backupFileName("db", ".sql.gz", created))
+	if err := DumpDatabase(dbName, target); err != nil {
+		return BackupFile{}, stepFailed("Back up database for "+site, err)
+	}
+	backup := BackupFile{Site: site, Kind: "db", Path: target, Created: created}
+	if info, err := os.Stat(target); err == nil {
+		backup.Size = info.Size()
+	}
+	return backup, nil
+}
+
+var backupDatabaseArgs struct {
+	dir string
+}
+
+func backupDatabaseFlags(fs *flag.FlagSet) {
+	allSitesFlag(fs)
+	fs.StringVar(&backupDatabaseArgs.dir, "dir", "", "backups directory (default from config)")
+}
+
+func backupDatabase() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+	backupsDir := config.BackupsDir
+	if backupDatabaseArgs.dir != "" {
+		backupsDir = backupDatabaseArgs.dir
+	}
+
+	return runBackups("Backing up databases...", func(site string) (BackupFile, error) {
+		return BackupDatabase(site, backupsDir)
+	})
+}
+
+// runBackups backs up every target site, carrying on past failures so one
+// broken site doesn't stop the rest.
+func runBackups(title string, backup func(site string) (BackupFile, error)) error {
+	var backups []BackupFile
+	var failed []error
+	err := spin(title, func() error {
+		for _, site := range targetSites() {
+			file, err := backup(site)
+			if err != nil {
+				failed = append(failed, err)
+				continue
+			}
+			backups = append(backups, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, backup := range backups {
+		fmt.Fprintf(&sb, "%s (%s)\n", backup.Path, FormatBytes(backup.Size))
+		if backup.DatabaseSkipped != "" {
+			fmt.Fprintf(&sb, "  no database: %s\n", backup.DatabaseSkipped)
+		}
+	}
+	if len(backups) > 0 {
+		printInBox(strings.TrimSpace(sb.String()) + "\n\nBacked up. Have a stellar day!")
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	// the exit handler prints the first failure
+	for _, err := range failed[1:] {
+		printInBox(renderError(err))
+	}
+	return failed[0]
+}
+
+// tar flag for each archive format
+var archiveFormats = map[string]string{"gz": "--gzip", "zst": "--zstd"}
+
+const manifestVersion = 1
+
+// BackupManifest describes a site archive. It is stored as manifest.json
+// next to the site folder and database.sql.gz inside the archive.
+type BackupManifest struct {
+	Version      int       `json:"version"`
+	Site         string    `json:"site"`
+	Created      time.Time `json:"created"`
+	Domains      []string  `json:"domains"`
+	Database     string    `json:"database,omitempty"`
+	DatabaseUser string    `json:"database_user,omitempty"`
+	Template     string    `json:"template"`
+	// why the archive has no database.sql.gz
+	DatabaseSkipped string `json:"database_skipped,omitempty"`
+}
+
+// BackupSite archives a site folder together with a database dump and a
+// manifest into the site's backup folder.
+func BackupSite(site, backupsDir, format string) (BackupFile, error) {
+	return archiveSite(site, backupsDir, format, "")
+}
+
+// archiveSite is BackupSite, leaving the database out when skipDatabase
+// gives a reason to.
+func archiveSite(site, backupsDir, format, skipDatabase string) (BackupFile, error) {
+	compress, ok := archiveFormats[format]
+	if !ok {
+		return BackupFile{}, &UsageError{fmt.Sprintf("unknown backup format %q, use gz or zst", format)}
+	}
+
+	dir := sitePath(site)
+	manifest := BackupManifest{
+		Version:  manifestVersion,
+		Site:     site,
+		Created:  time.Now(),
+		Domains:  []string{},
+		Template: ReadSiteTemplateVersion(dir),
+	}
+	if compose, err := ReadComposeFile(dir + "/docker-compose.yml"); err == nil {
+		if domains, ok := compose.Label("wordpress", "caddy"); ok {
+			manifest.Domains = strings.Fields(domains)
+		}
+	}
+	// the archive holds only files when there is no database in the
+	// mariadb container to dump
+	values, err := ReadDefineValues(dir + "/wordpress/wp-config.php")
+	switch {
+	case skipDatabase != "":
+		manifest.DatabaseSkipped = skipDatabase
+	case errors.Is(err, fs.ErrNotExist):
+		// wp-config.php doesn't exist until WordPress is installed
+		manifest.DatabaseSkipped = "wp-config.php not found"
+	case err != nil:
+		return BackupFile{}, stepFailed("Find database for "+site, err)
+	default:
+		manifest.Database, manifest.DatabaseSkipped = localDatabase(values)
+		if manifest.Database != "" {
+			manifest.DatabaseUser = values["DB_USER"]
+		}
+	}
+
+	staging, err := os.MkdirTemp("", "boost-backup-")
+	if err != nil {
+		return BackupFile{}, stepFailed("Create temporary folder", err)
+	}
+	defer os.RemoveAll(staging)
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return BackupFile{}, err
+	}
+	err = do("write "+staging+"/manifest.json", func() error {
+		return os.WriteFile(staging+"/manifest.json", content, 0644)
+	})
+	if err != nil {
+		return BackupFile{}, stepFailed("Write manifest", err)
+	}
+	files := []string{"manifest.json"}
+	if manifest.Database != "" {
+		if err := DumpDatabase(manifest.Database, staging+"/database.sql.gz"); err != nil {
+			return BackupFile{}, stepFailed("Back up database for "+site, err)
+		}
+		files = append(files, "database.sql.gz")
+	}
+
+	target := filepath.Join(backupsDir, site, backupFileName("site", ".tar."+format, manifest.Created))
+	partial := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".partial")
+	err = do("mkdir -p "+filepath.Dir(target), func() error {
+		return os.MkdirAll(filepath.Dir(target), 0750)
+	})
+	if err != nil {
+		return BackupFile{}, stepFailed("Create backup folder", err)
+	}
+
+	// the wordpress folder belongs to nobody, so tar runs as root
+	args := append([]string{"-c", compress, "-f", partial, "-C", staging}, files...)
+	args = append(args, "-C", filepath.Dir(dir), site)
+	if _, err := sudoCommand("tar", args...).Step("Archive " + site); err != nil {
+		sudoCommand("rm", "-f", partial).Run()
+		return BackupFile{}, err
+	}
+	if _, err := sudoCommand("chown", USER+":", partial).Step("Set owner of archive"); err != nil {
+		sudoCommand("rm", "-f", partial).Run()
+		return BackupFile{}, err
+	}
+	err = do("mv "+partial+" "+target, func() error {
+		if err := os.Chmod(partial, 0640); err != nil {
+			return err
+		}
+		return os.Rename(partial, target)
+	})
+	if err != nil {
+		return BackupFile{}, stepFailed("Save archive", err)
+	}
+
+	backup := BackupFile{Site: site, Kind: "site", Path: target, Created: manifest.Created, DatabaseSkipped: manifest.DatabaseSkipped}
+	if info, err := os.Stat(target); err == nil {
+		backup.Size = info.Size()
+	}
+	return backup, nil
+}
+
+var backupSiteArgs struct {
+	dir    string
+	format string
+}
+
+func backupSiteFlags(fs *flag.FlagSet) {
+	allSitesFlag(fs)
+	fs.StringVar(&backupSiteArgs.dir, "dir", "", "backups directory (default from config)")
+	fs.StringVar(&backupSiteArgs.format, "format", "", "archive compression, gz or zst (default from config)")
+}
+
+func backupSite() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+	backupsDir := config.BackupsDir
+	if backupSiteArgs.dir != "" {
+		backupsDir = backupSiteArgs.dir
+	}
+	format := config.BackupFormat
+	if backupSiteArgs.format != "" {
+		format = backupSiteArgs.format
+	}
+	if _, ok := archiveFormats[format]; !ok {
+		return &UsageError{fmt.Sprintf("unknown backup format %q, use gz or zst", format)}
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	return runBackups("Backing up sites...", func(site string) (BackupFile, error) {
+		return BackupSite(site, backupsDir, format)
+	})
+}
+
+// backup file names: <kind>-<timestamp><ext>
+var backupNameRe = regexp.MustCompile(`^(db|site)-(\d{8}-\d{6})\.(sql\.gz|tar\.gz|tar\.zst)$`)
+
+// ListBackups returns every backup in the backups folder, newest first.
+// Files that don't look like backups are left out.
+func ListBackups(backupsDir string) ([]BackupFile, error) {
+	paths, err := filepath.Glob(filepath.Join(backupsDir, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var backups []BackupFile
+	for _, path := range paths {
+		match := backupNameRe.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			continue
+		}
+		created, err := time.ParseInLocation(backupTimeLayout, match[2], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, BackupFile{
+			Site:    filepath.Base(filepath.Dir(path)),
+			Kind:    match[1],
+			Path:    path,
+			Size:    info.Size(),
+			Created: created,
+		})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// ListSiteArchives returns the site archives in the backups folder, newest
+// first.
+func ListSiteArchives(backupsDir string) ([]BackupFile, error) {
+	backups, err := ListBackups(backupsDir)
+	if err != nil {
+		return nil, err
+	}
+	var archives []BackupFile
+	for _, backup := range backups {
+		if backup.Kind == "site" {
+			archives = append(archives, backup)
+		}
+	}
+	return archives, nil
+}
+
+// ReadBackupManifest reads manifest.json from a site archive.
+func ReadBackupManifest(archive string) (BackupManifest, error) {
+	var manifest BackupManifest
+	output, err := command("tar", "-xOf", archive, "manifest.json").ReadOnly().OutputStep("Read backup manifest")
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(output, &manifest); err != nil {
+		return manifest, stepFailed("Read backup manifest", err)
+	}
+	if manifest.Site == "" || manifest.Version > manifestVersion {
+		return manifest, stepFailed("Read backup manifest", fmt.Errorf("%s is not a site backup this version of boost can restore", archive))
+	}
+	return manifest, nil
+}
+
+var restoreSiteArgs struct {
+	file string
+}
+
+func restoreSiteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&restoreSiteArgs.file, "file", "", "site archive to restore")
+}
+
+func restoreSite() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+
+	file := restoreSiteArgs.file
+	if file == "" && !scripted {
+		archives, err := ListSiteArchives(config.BackupsDir)
+		if err != nil {
+			return stepFailed("Find backups", err)
+		}
+		if len(archives) == 0 {
+			return stepFailed("Find backups", fmt.Errorf("no site backups in %s", config.BackupsDir))
+		}
+		options := make([]huh.Option[string], 0, len(archives))
+		for _, archive := range archives {
+			options = append(options, huh.NewOption(fmt.Sprintf("%s  %s (%s)", archive.Site, filepath.Base(archive.Path), FormatBytes(archive.Size)), archive.Path))
+		}
+		err = prompt(huh.NewSelect[string]().
+			Title("Which backup?").
+			Options(options...).
+			Value(&file))
+		if err != nil {
+			return err
+		}
+	}
+	if file == "" {
+		return missing("file")
+	}
+
+	manifest, err := ReadBackupManifest(file)
+	if err != nil {
+		return err
+	}
+	site := manifest.Site
+	// older sites can have names ValidateSiteName rejects, but the name
+	// must still be a single folder under ~/sites
+	if site == "" || strings.ContainsAny(site, "/\\") || site[0] == '.' {
+		return stepFailed("Read backup manifest", fmt.Errorf("invalid site name %q in %s", site, file))
+	}
+	if manifest.Database != "" && !sqlNameRe.MatchString(manifest.Database) {
+		return stepFailed("Read backup manifest", fmt.Errorf("invalid database name %q in %s", manifest.Database, file))
+	}
+	if manifest.DatabaseUser != "" && !sqlNameRe.MatchString(manifest.DatabaseUser) {
+		return stepFailed("Read backup manifest", fmt.Errorf("invalid database user %q in %s", manifest.DatabaseUser, file))
+	}
+	siteDir := sitePath(site)
+	if SiteExists(site) {
+		return stepFailed("Check site", fmt.Errorf("%s already exists, delete it before restoring", siteDir))
+	}
+
+	// database credentials come from the archived wp-config.php
+	var dbUser, dbPass string
+	if manifest.Database != "" {
+		wpConfig, err := command("tar", "-xOf", file, site+"/wordpress/wp-config.php").ReadOnly().OutputStep("Read wp-config.php from backup")
+		if err != nil {
+			return err
+		}
+		values := ParseDefineValues(string(wpConfig))
+		dbUser, dbPass = values["DB_USER"], values["DB_PASSWORD"]
+		if dbUser == "" || dbPass == "" {
+			return stepFailed("Read wp-config.php from backup", fmt.Errorf("DB_USER or DB_PASSWORD not found"))
+		}
+		if !sqlNameRe.MatchString(dbUser) {
+			return stepFailed("Read wp-config.php from backup", fmt.Errorf("invalid DB_USER %q", dbUser))
+		}
+	}
+
+	database := orDash(manifest.Database)
+	if manifest.DatabaseSkipped != "" {
+		database += " (" + manifest.DatabaseSkipped + ")"
+	}
+	confirmed := true
+	confirm(
+		fmt.Sprintf("Restore %s from this backup?", site),
+		fmt.Sprintf("Created: %s\nDomains: %s\nDatabase: %s", manifest.Created.Local().Format("2006-01-02 15:04"), strings.Join(manifest.Domains, " "), database),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	// runFixPermissions works on the chosen site
+	chosenSite = site
+
+	var undo undoStack
+
+	err = spin("Restoring "+site+"...", func() error {
+		// the archive keeps owners and modes, so extract as root
+		undo.push("Removed "+siteDir, func() error {
+			_, err := sudoCommand("rm", "-rf", siteDir).Step("Remove directory")
+			return err
+		})
+		_, err := sudoCommand("tar", "-xf", file, "-C", filepath.Dir(siteDir), site).Step("Extract site files")
+		if err != nil {
+			return err
+		}
+
+		if manifest.Database != "" {
+			if err := createDatabase(&undo, manifest.Database, dbUser, dbPass); err != nil {
+				return err
+			}
+			staging, err := os.MkdirTemp("", "boost-restore-")
+			if err != nil {
+				return stepFailed("Create temporary folder", err)
+			}
+			defer os.RemoveAll(staging)
+			_, err = command("tar", "-xf", file, "-C", staging, "database.sql.gz").Step("Extract database dump")
+			if err != nil {
+				return err
+			}
+			if err := ImportDatabase(manifest.Database, staging+"/database.sql.gz"); err != nil {
+				return stepFailed("Import database", err)
+			}
+		}
+
+		if err := runFixPermissions(); err != nil {
+			return err
+		}
+
+		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" up -d
+		_, err = command("docker", "compose", "-f", siteDir+"/docker-compose.yml", "up", "-d").Step("Start containers")
+		if err != nil {
+			command("docker", "compose", "-f", siteDir+"/docker-compose.yml", "down").Run()
+		}
+		return err
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
+
+	printInBox("Restored " + site + ". Have a splendid day!")
+	return nil
+}
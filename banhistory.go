@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// banQuery prints the bans table of fail2ban's sqlite database as tab
+// separated rows. fail2ban is written in python, so its container always
+// has python with sqlite, unlike the sqlite3 command.
+const banQuery = `import sqlite3, sys
+db = sqlite3.connect("file:" + sys.argv[1] + "?mode=ro", uri=True)
+query = "SELECT jail, ip, timeofban, bantime, bancount FROM bans WHERE timeofban >= ? AND (? = '' OR jail = ?) ORDER BY timeofban"
+for row in db.execute(query, (int(sys.argv[2]), sys.argv[3], sys.argv[3])):
+    print("\t".join(str(value) for value in row))
+`
+
+// BanRecord is a ban from the fail2ban database.
+type BanRecord struct {
+	Jail   string    `json:"jail"`
+	IP     string    `json:"ip"`
+	Banned time.Time `json:"banned"`
+	// Bantime is in seconds, negative for a permanent ban
+	Bantime  int64 `json:"bantime"`
+	BanCount int   `json:"ban_count"`
+}
+
+// Expires returns when the ban is lifted, or false for a permanent ban.
+func (b BanRecord) Expires() (time.Time, bool) {
+	if b.Bantime < 0 {
+		return time.Time{}, false
+	}
+	return b.Banned.Add(time.Duration(b.Bantime) * time.Second), true
+}
+
+// ParseFail2banDBFile reads the path from `fail2ban-client get dbfile`.
+func ParseFail2banDBFile(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimLeft(line, "|`- \t")
+		if strings.HasPrefix(line, "/") {
+			return strings.TrimSpace(line), nil
+		}
+	}
+	return "", fmt.Errorf("fail2ban has no database: %q", strings.TrimSpace(output))
+}
+
+// ParseBanRecords reads the rows printed by banQuery.
+func ParseBanRecords(output string) ([]BanRecord, error) {
+	var records []BanRecord
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected ban row %q", line)
+		}
+		// fail2ban stores seconds, sometimes as a float
+		banned, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("ban row %q: %w", line, err)
+		}
+		bantime, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ban row %q: %w", line, err)
+		}
+		count, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("ban row %q: %w", line, err)
+		}
+		records = append(records, BanRecord{
+			Jail:     fields[0],
+			IP:       fields[1],
+			Banned:   time.Unix(int64(banned), 0),
+			Bantime:  bantime,
+			BanCount: count,
+		})
+	}
+	return records, nil
+}
+
+// BanHistory returns the bans since a time, oldest first. An empty jail
+// means all jails.
+func BanHistory(jail string, since time.Time) ([]BanRecord, error) {
+	output, err := fail2banClient("get", "dbfile").ReadOnly().OutputStep("Find fail2ban database")
+	if err != nil {
+		return nil, err
+	}
+	dbFile, err := ParseFail2banDBFile(string(output))
+	if err != nil {
+		return nil, stepFailed("Find fail2ban database", err)
+	}
+
+	var from int64
+	if !since.IsZero() {
+		from = since.Unix()
+	}
+	// docker exec fail2ban python3 -c "$banQuery" $dbFile $from $jail
+	output, err = command("docker", "exec", "fail2ban", "python3", "-c", banQuery, dbFile, strconv.FormatInt(from, 10), jail).ReadOnly().OutputStep("Read ban history")
+	if err != nil {
+		return nil, err
+	}
+	records, err := ParseBanRecords(string(output))
+	if err != nil {
+		return nil, stepFailed("Read ban history", err)
+	}
+	return records, nil
+}
+
+// Offender is an IP with all its bans in the history.
+type Offender struct {
+	IP      string    `json:"ip"`
+	Bans    int       `json:"bans"`
+	Jails   []string  `json:"jails"`
+	LastBan time.Time `json:"last_ban"`
+	// Expires is when the latest ban is lifted, nil when it never is
+	Expires *time.Time `json:"expires"`
+	// Country is an ISO code, set by LookupCountries
+	Country string `json:"country,omitempty"`
+}
+
+// TopOffenders groups bans by IP, most banned first.
+func TopOffenders(records []BanRecord) []Offender {
+	byIP := make(map[string]*Offender)
+	var offenders []*Offender
+	for _, record := range records {
+		offender := byIP[record.IP]
+		if offender == nil {
+			offender = &Offender{IP: record.IP}
+			byIP[record.IP] = offender
+			offenders = append(offenders, offender)
+		}
+		offender.Bans++
+		if !slices.Contains(offender.Jails, record.Jail) {
+			offender.Jails = append(offender.Jails, record.Jail)
+		}
+		if !record.Banned.Before(offender.LastBan) {
+			offender.LastBan = record.Banned
+			offender.Expires = nil
+			if expires, ok := record.Expires(); ok {
+				offender.Expires = &expires
+			}
+		}
+	}
+
+	sorted := make([]Offender, 0, len(offenders))
+	for _, offender := range offenders {
+		sorted = append(sorted, *offender)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Bans != sorted[j].Bans {
+			return sorted[i].Bans > sorted[j].Bans
+		}
+		return sorted[i].LastBan.After(sorted[j].LastBan)
+	})
+	return sorted
+}
+
+// country database in MaxMind's format, where geoipupdate puts it
+const defaultGeoDB = "/usr/share/GeoIP/GeoLite2-Country.mmdb"
+
+var mmdbStringRe = regexp.MustCompile(`"([^"]*)"\s*<utf8_string>`)
+
+// ParseMMDBCountry reads the country code from the output of
+// `mmdblookup --ip <ip> country iso_code`.
+func ParseMMDBCountry(output string) string {
+	match := mmdbStringRe.FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// LookupCountries sets the country of each offender from a country
+// database with mmdblookup. Addresses the database doesn't know, like
+// private ones, are left without a country.
+func LookupCountries(offenders []Offender, db string) error {
+	for i := range offenders {
+		// a banned range is looked up by its first address
+		ip, _, _ := strings.Cut(offenders[i].IP, "/")
+		// mmdblookup --file $db --ip $ip country iso_code
+		output, err := command("mmdblookup", "--file", db, "--ip", ip, "country", "iso_code").ReadOnly().Output()
+		if errors.Is(err, exec.ErrNotFound) {
+			return stepFailed("Look up countries", fmt.Errorf("mmdblookup not found, install it with apt install mmdb-bin"))
+		}
+		// mmdblookup fails for addresses it has no entry for
+		if err == nil {
+			offenders[i].Country = ParseMMDBCountry(string(output))
+		}
+	}
+	return nil
+}
+
+// BanPeriod is the number of bans that started in a period.
+type BanPeriod struct {
+	Start time.Time `json:"start"`
+	Bans  int       `json:"bans"`
+}
+
+// banBucket is the length of the periods of a timeline.
+type banBucket struct {
+	name     string
+	layout   string
+	truncate func(time.Time) time.Time
+	next     func(time.Time) time.Time
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// banBuckets keeps a timeline to at most about a hundred rows: hours for up
+// to two days, then days, weeks starting on Monday, and months.
+var banBuckets = []struct {
+	upTo time.Duration
+	banBucket
+}{
+	{48 * time.Hour, banBucket{"hour", "Mon 15:04",
+		func(t time.Time) time.Time { return t.Truncate(time.Hour) },
+		func(t time.Time) time.Time { return t.Add(time.Hour) }}},
+	{90 * 24 * time.Hour, banBucket{"day", "Mon 2006-01-02",
+		startOfDay,
+		func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }}},
+	{2 * 365 * 24 * time.Hour, banBucket{"week", "2006-01-02",
+		func(t time.Time) time.Time { return startOfDay(t).AddDate(0, 0, -(int(t.Weekday())+6)%7) },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }}},
+	{0, banBucket{"month", "Jan 2006",
+		func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()) },
+		func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }}},
+}
+
+// BansOverTime counts bans per period from since to now, picking hours,
+// days, weeks or months by the length of the window. A zero since starts
+// at the first ban. Periods without bans are included. It also returns the
+// name of the period.
+func BansOverTime(records []BanRecord, since, now time.Time) ([]BanPeriod, string) {
+	if len(records) == 0 {
+		return nil, ""
+	}
+	if since.IsZero() {
+		since = records[0].Banned
+	}
+	bucket := banBuckets[len(banBuckets)-1].banBucket
+	for _, b := range banBuckets {
+		if now.Sub(since) <= b.upTo {
+			bucket = b.banBucket
+			break
+		}
+	}
+
+	var periods []BanPeriod
+	index := make(map[time.Time]int)
+	for start := bucket.truncate(since); !start.After(now); start = bucket.next(start) {
+		index[start] = len(periods)
+		periods = append(periods, BanPeriod{Start: start})
+	}
+	for _, record := range records {
+		if i, ok := index[bucket.truncate(record.Banned)]; ok {
+			periods[i].Bans++
+		}
+	}
+	return periods, bucket.name
+}
+
+// banPeriodLayout returns the time layout for periods named by
+// BansOverTime.
+func banPeriodLayout(name string) string {
+	for _, b := range banBuckets {
+		if b.name == name {
+			return b.layout
+		}
+	}
+	return time.DateTime
+}
+
+// parseWindow reads a time window like 24h, 7d or all. all returns zero.
+func parseWindow(s string) (time.Duration, error) {
+	if s == "all" {
+		return 0, nil
+	}
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
+
+// formatUntil describes when a ban ends, relative to now.
+func formatUntil(expires *time.Time, now time.Time) string {
+	if expires == nil {
+		return "never"
+	}
+	d := expires.Sub(now)
+	switch {
+	case d <= 0:
+		return "expired"
+	case d < time.Hour:
+		return fmt.Sprintf("in %dm", int(d.Minutes())+1)
+	case d < 48*time.Hour:
+		return fmt.Sprintf("in %dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("in %dd", int(d.Hours()/24))
+	}
+}
+
+var banHistoryArgs = struct {
+	jail   string
+	window string
+	top    int
+	geoDB  string
+	json   bool
+}{window: "7d", top: 10}
+
+func banHistoryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&banHistoryArgs.jail, "jail", "", "only show bans from this jail")
+	fs.StringVar(&banHistoryArgs.window, "since", "7d", "time window like 24h, 7d or all")
+	fs.IntVar(&banHistoryArgs.top, "top", 10, "number of IPs to show, 0 for all")
+	fs.StringVar(&banHistoryArgs.geoDB, "geo-db", "", "country database for mmdblookup (default "+defaultGeoDB+" if it exists)")
+	fs.BoolVar(&banHistoryArgs.json, "json", false, "print as JSON")
+}
+
+func banHistory() error {
+	jail := banHistoryArgs.jail
+	window := banHistoryArgs.window
+
+	if !scripted {
+		jails, err := Fail2banJails()
+		if err != nil {
+			return err
+		}
+		jailOptions := []huh.Option[string]{huh.NewOption("All jails", "")}
+		for _, name := range jails {
+			jailOptions = append(jailOptions, huh.NewOption(name, name))
+		}
+		form := huh.NewForm(
+			huh.NewGroup(
+				huh.NewSelect[string]().
+					Title("Select jail").
+					Options(jailOptions...).
+					Value(&jail),
+
+				huh.NewSelect[string]().
+					Title("Select time window").
+					Options(
+						huh.NewOption("Last 24 hours", "24h"),
+						huh.NewOption("Last 7 days", "7d"),
+						huh.NewOption("Last 30 days", "30d"),
+						huh.NewOption("Everything", "all"),
+					).
+					Value(&window),
+			),
+		)
+		if err := prompt(form); err != nil {
+			return err
+		}
+	}
+
+	duration, err := parseWindow(window)
+	if err != nil {
+		return &UsageError{err.Error() + ", use a duration like 24h, 7d or all"}
+	}
+	if banHistoryArgs.geoDB != "" {
+		if _, err := os.Stat(banHistoryArgs.geoDB); err != nil {
+			return &UsageError{"invalid --geo-db: " + err.Error()}
+		}
+	}
+	now := time.Now()
+	var since time.Time
+	if duration > 0 {
+		since = now.Add(-duration)
+	}
+
+	var records []BanRecord
+	err = spin("Reading ban history...", func() error {
+		var err error
+		records, err = BanHistory(jail, since)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	offenders := TopOffenders(records)
+	if banHistoryArgs.top > 0 && len(offenders) > banHistoryArgs.top {
+		offenders = offenders[:banHistoryArgs.top]
+	}
+	periods, period := BansOverTime(records, since, now)
+
+	// countries are shown when there is a database to look them up in
+	geoDB := banHistoryArgs.geoDB
+	if _, err := os.Stat(defaultGeoDB); geoDB == "" && err == nil {
+		geoDB = defaultGeoDB
+	}
+	geo := false
+	if geoDB != "" && len(offenders) > 0 {
+		err := spin("Looking up countries...", func() error {
+			return LookupCountries(offenders, geoDB)
+		})
+		// without --geo-db, a server without mmdblookup just has no countries
+		if err != nil && banHistoryArgs.geoDB != "" {
+			return err
+		}
+		geo = err == nil
+	}
+
+	if banHistoryArgs.json {
+		return printJSON(struct {
+			Offenders []Offender  `json:"offenders"`
+			Period    string      `json:"period"`
+			Timeline  []BanPeriod `json:"timeline"`
+		}{offenders, period, periods})
+	}
+	if len(records) == 0 {
+		printInBox("No bans in this window. Have a peaceful day!")
+		return nil
+	}
+
+	headers := []string{"IP", "Bans", "Jails", "Last ban", "Expires"}
+	if geo {
+		headers = slices.Insert(headers, 1, "Country")
+	}
+	rows := make([][]string, 0, len(offenders))
+	for _, offender := range offenders {
+		row := []string{
+			offender.IP,
+			strconv.Itoa(offender.Bans),
+			strings.Join(offender.Jails, ", "),
+			offender.LastBan.Format("2006-01-02 15:04"),
+			formatUntil(offender.Expires, now),
+		}
+		if geo {
+			row = slices.Insert(row, 1, orDash(offender.Country))
+		}
+		rows = append(rows, row)
+	}
+	fmt.Println(renderTable(headers, rows))
+
+	layout := banPeriodLayout(period)
+	most := 0
+	for _, period := range periods {
+		most = max(most, period.Bans)
+	}
+	bar := lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
+	rows = make([][]string, 0, len(periods))
+	for _, period := range periods {
+		rows = append(rows, []string{
+			period.Start.Format(layout),
+			strconv.Itoa(period.Bans),
+			bar.Render(strings.Repeat("█", period.Bans*progressBarWidth/max(most, 1))),
+		})
+	}
+	fmt.Println(renderTable([]string{strings.ToUpper(period[:1]) + period[1:], "Bans", ""}, rows))
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseBanRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []BanRecord
+		wantErr bool
+	}{
+		{
+			name: "rows",
+			output: "sshd\t203.0.113.7\t1760659200\t600\t1\n" +
+				"wordpress\t198.51.100.23\t1760662812.4417431\t3600\t3\n" +
+				"boost-permanent\t192.0.2.0/24\t1760666400\t-1\t1\n",
+			want: []BanRecord{
+				{Jail: "sshd", IP: "203.0.113.7", Banned: time.Unix(1760659200, 0), Bantime: 600, BanCount: 1},
+				{Jail: "wordpress", IP: "198.51.100.23", Banned: time.Unix(1760662812, 0), Bantime: 3600, BanCount: 3},
+				{Jail: "boost-permanent", IP: "192.0.2.0/24", Banned: time.Unix(1760666400, 0), Bantime: -1, BanCount: 1},
+			},
+		},
+		{name: "no bans", output: "", want: nil},
+		{name: "short row", output: "sshd\t203.0.113.7\t1760659200\n", wantErr: true},
+		{name: "bad time", output: "sshd\t203.0.113.7\tyesterday\t600\t1\n", wantErr: true},
+		{name: "python error", output: "Traceback (most recent call last):\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBanRecords(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBansOverTime(t *testing.T) {
+	// a Friday afternoon
+	now := time.Date(2026, 10, 16, 15, 30, 0, 0, time.UTC)
+	at := func(d time.Duration) BanRecord { return BanRecord{Banned: now.Add(-d)} }
+	records := []BanRecord{at(50 * time.Hour), at(3 * time.Hour), at(2*time.Hour + 10*time.Minute), at(10 * time.Minute)}
+
+	tests := []struct {
+		name       string
+		since      time.Time
+		wantBucket string
+		wantLen    int
+		// bans in the first periods and the last period
+		wantFirst []int
+		wantLast  int
+	}{
+		{"a day by the hour", now.Add(-24 * time.Hour), "hour", 25, []int{0}, 1},
+		{"a week by the day", now.Add(-7 * 24 * time.Hour), "day", 8, []int{0, 0, 0, 0, 0, 1, 0}, 3},
+		{"since the first ban", time.Time{}, "day", 3, []int{1, 0}, 3},
+		{"a year by the week", now.AddDate(-1, 0, 0), "week", 53, []int{0}, 4},
+		{"five years by the month", now.AddDate(-5, 0, 0), "month", 61, []int{0}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, bucket := BansOverTime(records, tt.since, now)
+			if bucket != tt.wantBucket || len(periods) != tt.wantLen {
+				t.Fatalf("got %d periods of a %s, want %d of a %s", len(periods), bucket, tt.wantLen, tt.wantBucket)
+			}
+			for i, want := range tt.wantFirst {
+				if periods[i].Bans != want {
+					t.Errorf("period %d has %d bans, want %d", i, periods[i].Bans, want)
+				}
+			}
+			if last := periods[len(periods)-1].Bans; last != tt.wantLast {
+				t.Errorf("last period has %d bans, want %d", last, tt.wantLast)
+			}
+			total := 0
+			for _, period := range periods {
+				total += period.Bans
+			}
+			if total > len(records) {
+				t.Errorf("counted %d bans of %d", total, len(records))
+			}
+		})
+	}
+
+	// weeks start on Monday
+	periods, _ := BansOverTime(records, now.AddDate(-1, 0, 0), now)
+	if last := periods[len(periods)-1].Start; last != time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("last week starts %v, want Monday the 12th", last)
+	}
+
+	if periods, bucket := BansOverTime(nil, time.Time{}, now); periods != nil || bucket != "" {
+		t.Errorf("got %v %q for no bans", periods, bucket)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"24h", 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"all", 0, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"7days", 0, true},
+		{"week", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.window)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseWindow(%q) = %v, %v, want %v, error %v", tt.window, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseMMDBCountry(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"found", "\n  \"DE\" <utf8_string>\n\n", "DE"},
+		{"not in the database", "", ""},
+		{"no country", "\n  Could not find an entry for this IP address (10.0.0.1)\n\n", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseMMDBCountry(tt.output); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLookupCountries(t *testing.T) {
+	r := &fakeRunner{
+		outputs: map[string]string{
+			"--ip 203.0.113.7 ": "\n  \"US\" <utf8_string>\n\n",
+			"--ip 192.0.2.0 ":   "\n  \"NL\" <utf8_string>\n\n",
+		},
+		fail: "--ip 10.0.0.1 ",
+	}
+	useFakeRunner(t, r)
+	offenders := []Offender{{IP: "203.0.113.7"}, {IP: "192.0.2.0/24"}, {IP: "10.0.0.1"}}
+
+	if err := LookupCountries(offenders, "/usr/share/GeoIP/GeoLite2-Country.mmdb"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, offender := range offenders {
+		got = append(got, offender.Country)
+	}
+	if want := []string{"US", "NL", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	assertRanInOrder(t, r, "mmdblookup --file /usr/share/GeoIP/GeoLite2-Country.mmdb --ip 203.0.113.7 country iso_code")
+}
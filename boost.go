@@ -1,15 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
-	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/huh"
-	"github.com/charmbracelet/huh/spinner"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -25,41 +25,69 @@ var chosenSite string
 
 type Option struct {
 	name       string
+	command    string
 	chooseSite bool
-	action     func()
+	action     func() error
+	flags      func(fs *flag.FlagSet)
 }
 
 var options = []Option{
-	{"Create Site", false, createSite},
-	{"Start Site", true, startSite},
-	{"Stop Site", true, stopSite},
-	{"Restart Site", true, restartSite},
-	{"Delete Site & Files", true, deleteSite},
-	{"Change Domain / SSL", true, changeSiteDomain},
-	{"Container Shell", true, containerShell},
-	{"Fix Permissions", true, fixPermissions},
-	{"Migrate Files", true, migrateFiles},
-	{"Optimize Images", true, optimizeImages},
-	{"Database Search Replace", true, databaseSearchReplace},
-	{"Import WP Database", true, importWPDatabase},
-	{"Update WP Database Config", true, changeDatabaseInfo},
-	{"Toggle WP Maintenance Mode", true, maintenanceMode},
-	{"Server Status", false, serverStatus},
-	{"Add SSH Key", false, addSSHKey},
-	{"Generate / View SSH Key", false, generateSshKey},
-	{"Prune Docker Images", false, pruneDockerImages},
-	{"MariaDB Upgrade", false, mariadbUpgrade},
-	{"Fail2ban Status", false, fail2banStatus},
-	{"Unban IP", false, unbanIp},
-	{"Whitelist IP", false, whitelistIp},
+	{"Create Site", "create", false, createSite, createSiteFlags},
+	{"List Sites", "list", false, listSites, listSitesFlags},
+	{"Start Site", "start", true, startSite, nil},
+	{"Stop Site", "stop", true, stopSite, nil},
+	{"Restart Site", "restart", true, restartSite, nil},
+	{"Delete Site & Files", "delete", true, deleteSite, deleteSiteFlags},
+	{"Change Domain / SSL", "domain", true, changeSiteDomain, changeSiteDomainFlags},
+	{"Clone Site", "clone", true, cloneSite, cloneSiteFlags},
+	{"Promote Site", "promote", true, promoteSite, promoteSiteFlags},
+	{"Container Shell", "shell", true, containerShell, nil},
+	{"Site Logs", "logs", true, siteLogs, siteLogsFlags},
+	{"Fix Permissions", "fix-permissions", true, fixPermissions, nil},
+	{"Migrate Files", "migrate", true, migrateFiles, migrateFilesFlags},
+	{"Migrate Whole Site", "migrate-site", true, migrateSite, migrateSiteFlags},
+	{"Optimize Images", "optimize-images", true, optimizeImages, nil},
+	{"Database Search Replace", "search-replace", true, databaseSearchReplace, databaseSearchReplaceFlags},
+	{"Import WP Database", "import-db", true, importWPDatabase, nil},
+	{"Backup Database", "backup-db", true, backupDatabase, backupDatabaseFlags},
+	{"Backup Site", "backup", true, backupSite, backupSiteFlags},
+	{"Restore Site", "restore", false, restoreSite, restoreSiteFlags},
+	{"Prune Backups", "prune-backups", false, pruneBackups, pruneBackupsFlags},
+	{"Update WP Database Config", "db-config", true, changeDatabaseInfo, changeDatabaseInfoFlags},
+	{"Rotate DB Password", "rotate-db-password", true, rotateDatabasePassword, rotateDatabasePasswordFlags},
+	{"Database Users", "db-users", false, listDatabaseUsers, listDatabaseUsersFlags},
+	{"Drop Orphaned DB Users", "drop-orphaned-db-users", false, dropOrphanedDatabaseUsers, nil},
+	{"Toggle WP Maintenance Mode", "maintenance", true, maintenanceMode, maintenanceModeFlags},
+	{"Server Status", "status", false, serverStatus, nil},
+	{"Audit Sites", "audit", false, audit, auditFlags},
+	{"Add SSH Key", "add-ssh-key", false, addSSHKey, addSSHKeyFlags},
+	{"Generate / View SSH Key", "ssh-key", false, generateSshKey, generateSshKeyFlags},
+	{"Prune Docker Images", "prune-images", false, pruneDockerImages, nil},
+	{"MariaDB Upgrade", "mariadb-upgrade", false, mariadbUpgrade, nil},
+	{"Fail2ban Status", "fail2ban-status", false, fail2banStatus, fail2banStatusFlags},
+	{"Ban History", "ban-history", false, banHistory, banHistoryFlags},
+	{"Ban IP", "ban", false, banIp, banIpFlags},
+	{"Unban IP", "unban", false, unbanIp, unbanIpFlags},
+	{"Whitelist IP", "whitelist", false, whitelistIp, whitelistIpFlags},
+	{"List Whitelist", "whitelist-list", false, listWhitelist, listWhitelistFlags},
+	{"Remove Whitelisted IP", "unwhitelist", false, unwhitelistIp, unwhitelistIpFlags},
 }
 
 func main() {
-	CheckForUpdate()
-	introForm()
+	args := parseGlobalFlags(os.Args[1:])
+	if len(args) > 0 {
+		exit(runCommand(args))
+	}
+	applyGlobalFlags()
+	if !dryRun {
+		if err := CheckForUpdate(); err != nil {
+			exit(err)
+		}
+	}
+	exit(introForm())
 }
 
-func introForm() {
+func introForm() error {
 	// reset cursor to beginning of line
 	fmt.Print("\033[0G")
 
@@ -69,6 +97,8 @@ func introForm() {
 		allOptions = append(allOptions, option.name)
 	}
 
+	sites := GetDirectoriesInPath("/home/" + USER + "/sites")
+
 	form := huh.NewForm(
 		// Ask the user what they want to do.
 		huh.NewGroup(
@@ -85,13 +115,30 @@ func introForm() {
 			huh.NewSelect[string]().
 				Title("Which site?").
 				Options(
-					huh.NewOptions(GetDirectoriesInPath("/home/"+USER+"/sites")...)...,
+					huh.NewOptions(sites...)...,
+				).
+				Value(&chosenSite),
+		).WithHideFunc(func() bool {
+			for _, option := range options {
+				if chosenOption == option.name {
+					return !option.chooseSite || supportsAllSites(option)
+				}
+			}
+			return true
+		}),
+
+		// Ask the user for a site, or all of them.
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Which site?").
+				Options(
+					append([]huh.Option[string]{huh.NewOption("All sites", allSitesChoice)}, huh.NewOptions(sites...)...)...,
 				).
 				Value(&chosenSite),
 		).WithHideFunc(func() bool {
 			for _, option := range options {
 				if chosenOption == option.name {
-					return !option.chooseSite
+					return !option.chooseSite || !supportsAllSites(option)
 				}
 			}
 			return true
@@ -100,18 +147,22 @@ func introForm() {
 
 	err := form.Run()
 	if err != nil {
-		log.Fatal(err)
+		return formAborted(err)
+	}
+
+	if chosenSite == allSitesChoice {
+		allSites = true
+		chosenSite = ""
 	}
 
 	// Run the chosen action
 	for _, option := range options {
 		if option.name == chosenOption {
-			option.action()
-			return
+			return option.action()
 		}
 	}
 
-	buhBye()
+	return errAborted
 }
 
 func printInBox(content string) {
@@ -126,78 +177,76 @@ func printInBox(content string) {
 	fmt.Println()
 }
 
-// Exit script
-func buhBye() {
-	printInBox("Buh bye!")
-	os.Exit(0)
+// Grant sudo permissions
+func getSudo() error {
+	// dry runs still run read only commands with sudo, so they ask too
+	err := command("sudo", "-v").ReadOnly().Run()
+	return stepFailed("Grant sudo permissions", err)
 }
 
-func checkError(err error, msg string) {
+func startSite() error {
+	err := spin("Starting "+chosenSite+"...", func() error {
+		_, err := command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "up", "-d").Step("Start containers")
+		return err
+	})
 	if err != nil {
-		printInBox(fmt.Sprintf("Command failed with error:\n\n%s", strings.TrimSpace(msg)))
-		os.Exit(1)
+		return err
 	}
-}
-
-// Grant sudo permissions
-func getSudo() {
-	err := exec.Command("sudo", "-v").Run()
-	checkError(err, "Failed to grant sudo permissions.")
-}
-
-func startSite() {
-	var err error
-	var output []byte
-	//spinner
-	spinner.New().Title("Starting " + chosenSite + "...").Action(func() {
-		cmd := exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "up", "-d")
-		output, err = cmd.CombinedOutput()
-	}).Run()
-	checkError(err, string(output))
 	fmt.Println("Site started. Have a wonderful day!")
+	return nil
 }
 
-func stopSite() {
-	var err error
-	var output []byte
-
-	spinner.New().Title("Stopping " + chosenSite + "...").Action(func() {
+func stopSite() error {
+	err := spin("Stopping "+chosenSite+"...", func() error {
 		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" stop
-		cmd := exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "stop")
-		output, err = cmd.CombinedOutput()
-	}).Run()
-
-	checkError(err, string(output))
+		_, err := command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "stop").Step("Stop containers")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	fmt.Println("Site stopped. Have a phenomenal day!")
+	return nil
 }
 
-func createSite() {
-	var sitename string
-	var domain string
-	php7 := false
-	createDb := true
+var createSiteArgs = struct {
+	name   string
+	domain string
+	php7   bool
+	db     bool
+
+	templateSource    string
+	templateChecksums string
+}{db: true}
+
+func createSiteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&createSiteArgs.name, "name", "", "site name")
+	fs.StringVar(&createSiteArgs.domain, "domain", "", "domain(s), separated with a space")
+	fs.BoolVar(&createSiteArgs.php7, "php7", false, "use the PHP 7 image")
+	fs.BoolVar(&createSiteArgs.db, "db", true, "create database")
+	fs.StringVar(&createSiteArgs.templateSource, "template-source", "", "site templates: a local directory or git:<ref> (default: embedded)")
+	fs.StringVar(&createSiteArgs.templateChecksums, "template-checksums", "", "sha256sum manifest that downloaded templates must match")
+}
+
+func createSite() error {
+	sitename := createSiteArgs.name
+	domain := createSiteArgs.domain
+	php7 := createSiteArgs.php7
+	createDb := createSiteArgs.db
 
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
 				Title("Enter site name").
 				Validate(func(s string) error {
-					if s == "" {
-						return fmt.Errorf("site name cannot be empty")
-					}
-					return nil
+					return ValidateSiteName(ReplaceSpacesWithDashes(s))
 				}).
 				Value(&sitename),
 
 			huh.NewInput().
 				Title("Enter domain(s)").
 				Description("Separate domains with a space.").
-				Validate(func(s string) error {
-					if s == "" {
-						return fmt.Errorf("domain cannot be empty")
-					}
-					return nil
-				}).
+				Validate(ValidateDomains).
 				Value(&domain),
 
 			huh.NewConfirm().
@@ -210,91 +259,157 @@ func createSite() {
 		),
 	)
 
-	err := form.Run()
-	if err != nil {
-		log.Fatal(err)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if sitename == "" || domain == "" {
+		return missing("name", "domain")
+	}
+	if err := ValidateDomains(domain); err != nil {
+		return &UsageError{err.Error()}
 	}
 
 	sitename = ReplaceSpacesWithDashes(sitename)
+	if err := ValidateSiteName(sitename); err != nil {
+		return &UsageError{err.Error()}
+	}
 
 	var db_name string
 	var db_user string
 	var db_pass string
 
-	const repo_base = "https://raw.githubusercontent.com/BOOST-Creative/docker-server-setup-caddy/main"
-
-	type Download struct {
-		source string
-		target string
+	templates, err := LoadTemplates(createSiteArgs.templateSource, createSiteArgs.templateChecksums)
+	if err != nil {
+		return stepFailed("Load site templates", err)
 	}
+	defer templates.Close()
 
-	wordpressCompose := Download{
-		source: repo_base + "/wordpress/docker-compose.yml",
-		target: "/home/" + USER + "/sites/" + sitename + "/docker-compose.yml",
-	}
-	htNinja := Download{
-		source: repo_base + "/wordpress/.htninja",
-		target: "/home/" + USER + "/sites/" + sitename + "/.htninja",
-	}
-	redisConf := Download{
-		source: repo_base + "/wordpress/redis.conf",
-		target: "/home/" + USER + "/sites/" + sitename + "/redis.conf",
+	siteDir := "/home/" + USER + "/sites/" + sitename
+	composeFile := siteDir + "/docker-compose.yml"
+
+	if err := getSudo(); err != nil {
+		return err
 	}
 
-	getSudo()
+	var undo undoStack
 
 	// spinner
-	spinner.New().Title("Creating site...").Action(func() {
+	err = spin("Creating site...", func() error {
 		// create directory
-		err := os.MkdirAll("/home/"+USER+"/sites/"+sitename+"/wordpress", os.ModePerm)
-		checkError(err, "Failed to create directory.")
+		if SiteExists(sitename) {
+			return stepFailed("Create directory", fmt.Errorf("%s already exists", siteDir))
+		}
+		err := do("mkdir -p "+siteDir+"/wordpress", func() error {
+			return os.MkdirAll(siteDir+"/wordpress", os.ModePerm)
+		})
+		if err != nil {
+			return stepFailed("Create directory", err)
+		}
+		undo.push("Removed "+siteDir, func() error {
+			_, err := sudoCommand("rm", "-r", siteDir).Step("Remove directory")
+			return err
+		})
+
+		// copy template files
+		for _, name := range templateFiles {
+			target := siteDir + "/" + name
+			content, err := fs.ReadFile(templates.FS, name)
+			if err != nil {
+				return stepFailed("Read template "+name, err)
+			}
+			err = do("write "+target, func() error {
+				return os.WriteFile(target, content, 0644)
+			})
+			if err != nil {
+				return stepFailed("Write "+name, err)
+			}
+			undo.push("Removed "+target, func() error {
+				return do("remove "+target, func() error {
+					return os.Remove(target)
+				})
+			})
+		}
 
-		// download files
-		DownloadFile(wordpressCompose.source, wordpressCompose.target)
-		DownloadFile(htNinja.source, htNinja.target)
-		DownloadFile(redisConf.source, redisConf.target)
+		// record which templates the site was created from
+		versionFile := siteDir + "/" + templateVersionFile
+		err = do("write "+versionFile, func() error {
+			return os.WriteFile(versionFile, []byte(templates.Version+"\n"), 0644)
+		})
+		if err != nil {
+			return stepFailed("Record template version", err)
+		}
+		undo.push("Removed "+versionFile, func() error {
+			return do("remove "+versionFile, func() error {
+				return os.Remove(versionFile)
+			})
+		})
 
 		// replace stuff in wordpress docker compose
+		replacements := [][2]string{
+			{"CHANGE_TO_SITE_NAME", sitename},
+			{"CHANGE_TO_USERNAME", USER},
+		}
 		if php7 {
-			ReplaceTextInFile(wordpressCompose.target, "docker-wordpress-8", "docker-wordpress-7")
+			replacements = append([][2]string{{"docker-wordpress-8", "docker-wordpress-7"}}, replacements...)
+		}
+		for _, r := range replacements {
+			err := do(fmt.Sprintf("replace %s with %s in %s", r[0], r[1], composeFile), func() error {
+				return ReplaceTextInFile(composeFile, r[0], r[1])
+			})
+			if err != nil {
+				return stepFailed("Update docker-compose.yml", err)
+			}
 		}
-		ReplaceTextInFile(wordpressCompose.target, "CHANGE_TO_SITE_NAME", sitename)
-		ReplaceTextInFile(wordpressCompose.target, "CHANGE_TO_USERNAME", USER)
 
 		// update domain
-		cmd := exec.Command("yq", "-i", fmt.Sprintf(".services.wordpress.labels.caddy = \"%s\"", domain), wordpressCompose.target)
-		output, err := cmd.CombinedOutput()
-		checkError(err, string(output))
+		err = do("set caddy label to "+domain+" in "+composeFile, func() error {
+			return setCaddyLabels(composeFile, domain, nil)
+		})
+		if err != nil {
+			return stepFailed("Set domain", err)
+		}
 
 		// create container
 		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" create
-		cmd = exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+sitename+"/docker-compose.yml", "create")
-		_, err = cmd.CombinedOutput()
-		checkError(err, "Failed to create site.")
+		_, err = command("docker", "compose", "-f", composeFile, "create").Step("Create containers")
+		if err != nil {
+			return err
+		}
+		undo.push("Removed containers", func() error {
+			_, err := command("docker", "compose", "-f", composeFile, "rm", "-f").Step("Remove containers")
+			return err
+		})
 
 		// fix permissions
 		// sudo chown nobody: "/home/$CUR_USER/sites/$sitename/wordpress"
-		cmd = exec.Command("sudo", "chown", "nobody:", "/home/"+USER+"/sites/"+sitename+"/wordpress")
-		_, err = cmd.CombinedOutput()
-		checkError(err, "Failed to set permissions")
+		_, err = sudoCommand("chown", "nobody:", siteDir+"/wordpress").Step("Set permissions")
+		if err != nil {
+			return err
+		}
+		undo.push("Restored owner of "+siteDir+"/wordpress", func() error {
+			_, err := sudoCommand("chown", USER+":", siteDir+"/wordpress").Step("Restore owner")
+			return err
+		})
 
 		// create database
 		if createDb {
 			db_name = ReplaceDashWithUnderscore(sitename)
 			db_user = "u_" + ReplaceDashWithUnderscore(sitename)
 			db_pass, err = GeneratePassword(14)
-			checkError(err, "Failed to generate password.")
-			output, err := exec.Command("docker", "exec", "-e", "DB_NAME="+db_name, "mariadb", "bash", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"CREATE DATABASE $DB_NAME;\"").CombinedOutput()
-			checkError(err, string(output))
-			// create user
-			output, err = exec.Command("docker", "exec", "-e", "DB_USER="+db_user, "-e", "DB_PASSWORD="+db_pass, "mariadb", "bash", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"CREATE USER '$DB_USER'@'%' IDENTIFIED BY '$DB_PASSWORD';\"").CombinedOutput()
-			checkError(err, string(output))
-			// grant user privileges to database
-			output, err = exec.Command("docker", "exec", "-e", "DB_NAME="+db_name, "-e", "DB_USER="+db_user, "mariadb", "bash", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"GRANT ALL PRIVILEGES ON $DB_NAME.* TO '$DB_USER'@'%';\"").CombinedOutput()
-			checkError(err, string(output))
+			if err != nil {
+				return stepFailed("Generate password", err)
+			}
+			if err := createDatabase(&undo, db_name, db_user, db_pass); err != nil {
+				return err
+			}
 		}
 
-	}).Run()
+		return nil
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
 
 	var sb strings.Builder
 	msg := lipgloss.NewStyle().Bold(true).Render("Created " + sitename + "!")
@@ -316,80 +431,231 @@ func createSite() {
 	}
 
 	printInBox(sb.String())
+	return nil
 }
 
-func restartSite() {
-	var err error
-	var output []byte
-
-	spinner.New().Title("Restarting " + chosenSite + "...").Action(func() {
+func restartSite() error {
+	err := spin("Restarting "+chosenSite+"...", func() error {
 		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" stop
-		cmd := exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "restart")
-		output, err = cmd.CombinedOutput()
-	}).Run()
-
-	checkError(err, string(output))
+		_, err := command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "restart").Step("Restart containers")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	fmt.Println("Site Restarted. Have a superb day!")
+	return nil
 }
 
-func fixPermissions() {
-	getSudo()
+func fixPermissions() error {
+	if err := getSudo(); err != nil {
+		return err
+	}
 	// spinner
-	spinner.New().Title(fmt.Sprintf("Fixing permissions for %s...", chosenSite)).Action(runFixPermissions).Run()
+	err := spin(fmt.Sprintf("Fixing permissions for %s...", chosenSite), runFixPermissions)
+	if err != nil {
+		return err
+	}
 	printInBox("Permissions fixed. Have a fantastic day!")
+	return nil
+}
+
+func runFixPermissions() error {
+	return fixSitePermissions(chosenSite)
 }
 
-func runFixPermissions() {
+func fixSitePermissions(site string) error {
 	// sudo chown -R nobody: "/home/$CUR_USER/sites/$sitename/wordpress"
-	cmd := exec.Command("sudo", "chown", "-R", "nobody:", "/home/"+USER+"/sites/"+chosenSite+"/wordpress")
-	output, err := cmd.CombinedOutput()
-	checkError(err, string(output))
+	_, err := sudoCommand("chown", "-R", "nobody:", "/home/"+USER+"/sites/"+site+"/wordpress").Step("Set owner")
+	if err != nil {
+		return err
+	}
 	// sudo find "/home/$CUR_USER/sites/$sitename" -type d -exec chmod 755 {} +
-	cmd = exec.Command("sudo", "find", "/home/"+USER+"/sites/"+chosenSite, "-type", "d", "-exec", "chmod", "755", "{}", "+")
-	output, err = cmd.CombinedOutput()
-	checkError(err, string(output))
+	_, err = sudoCommand("find", "/home/"+USER+"/sites/"+site, "-type", "d", "-exec", "chmod", "755", "{}", "+").Step("Set directory permissions")
+	if err != nil {
+		return err
+	}
 	// sudo find "/home/$CUR_USER/sites/$sitename/wordpress" -type f -exec chmod 644 {} +
-	cmd = exec.Command("sudo", "find", "/home/"+USER+"/sites/"+chosenSite+"/wordpress", "-type", "f", "-exec", "chmod", "644", "{}", "+")
-	output, err = cmd.CombinedOutput()
-	checkError(err, string(output))
-}
-
-func deleteSite() {
-	// TODO: delete database
-	confirm := false
-	huh.NewConfirm().
-		Title(fmt.Sprintf("Are you sure you want to delete %s?", chosenSite)).
-		Description("This will COMPLETELY DELETE " + chosenSite + ".").
-		Value(&confirm).
-		Run()
-
-	if !confirm {
-		buhBye()
-	}
-
-	getSudo()
-	spinner.New().Title("Deleting site...").Action(func() {
-		db_name := strings.ReplaceAll(chosenSite, "-", "_")
-		// drop database
-		output, err := exec.Command("docker", "exec", "-e", "DB_NAME="+db_name, "mariadb", "bash", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"DROP DATABASE $DB_NAME;\"").CombinedOutput()
-		checkError(err, string(output))
-		// stop and remove containers
-		output, err = exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "stop").CombinedOutput()
-		checkError(err, string(output))
-		output, err = exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "rm").CombinedOutput()
-		checkError(err, string(output))
-		// remove site folder
-		output, err = exec.Command("sudo", "rm", "-r", "/home/"+USER+"/sites/"+chosenSite).CombinedOutput()
-		checkError(err, string(output))
-	}).Run()
-
-	printInBox("Deleted " + chosenSite)
-
-}
-
-func addSSHKey() {
-	var key string
-	huh.NewText().
+	_, err = sudoCommand("find", "/home/"+USER+"/sites/"+site+"/wordpress", "-type", "f", "-exec", "chmod", "644", "{}", "+").Step("Set file permissions")
+	return err
+}
+
+var deleteSiteArgs = struct {
+	backup bool
+}{backup: true}
+
+func deleteSiteFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&deleteSiteArgs.backup, "backup", true, "back up the site before deleting it")
+}
+
+func deleteSite() error {
+	siteDir := "/home/" + USER + "/sites/" + chosenSite
+	composeFile := siteDir + "/docker-compose.yml"
+	imageBackups := "/root/image-backups/" + chosenSite
+
+	// database details come from wp-config.php, falling back to the names createSite uses
+	db_name := ReplaceDashWithUnderscore(chosenSite)
+	db_user := "u_" + db_name
+	ownDatabase := true
+	if values, err := ReadDefineValues(siteDir + "/wordpress/wp-config.php"); err == nil {
+		if values["DB_NAME"] != "" {
+			db_name = values["DB_NAME"]
+		}
+		if values["DB_USER"] != "" {
+			db_user = values["DB_USER"]
+		}
+		// leave databases on other servers alone
+		if host := values["DB_HOST"]; host != "" && host != "mariadb" && !strings.HasPrefix(host, "mariadb:") {
+			ownDatabase = false
+		}
+	}
+
+	confirmed := false
+	confirm(
+		fmt.Sprintf("Are you sure you want to delete %s?", chosenSite),
+		fmt.Sprintf("This will COMPLETELY DELETE %s: containers and volumes, database %s, user %s, image backups and files.", chosenSite, db_name, db_user),
+		&confirmed,
+	)
+
+	if !confirmed {
+		return declined()
+	}
+
+	backup := deleteSiteArgs.backup
+	err := prompt(huh.NewConfirm().
+		Title("Back up the site first?").
+		Value(&backup))
+	if err != nil {
+		return err
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	// every step can run again, so a failed delete can be resumed
+	check := lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Render("✓")
+	skip := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("–")
+	report := func(mark, line string) {
+		fmt.Println(mark + " " + line)
+	}
+	step := func(title, done string, fn func() error) error {
+		if err := spin(title+"...", fn); err != nil {
+			return err
+		}
+		report(check, done)
+		return nil
+	}
+	_, statErr := os.Stat(composeFile)
+	hasCompose := statErr == nil
+
+	if !backup {
+		report(skip, "No final backup")
+	} else if !SiteExists(chosenSite) {
+		report(skip, "No final backup, "+siteDir+" is gone")
+	} else {
+		config, err := LoadConfig()
+		if err != nil {
+			return stepFailed("Load config", err)
+		}
+		var file BackupFile
+		err = step("Backing up "+chosenSite, "Backed up", func() error {
+			// a delete that stopped after dropping the database backs up
+			// the files only when it runs again
+			skipDatabase := ""
+			if ownDatabase {
+				databases, err := mariadbSelect("List databases", "mysql", "SHOW DATABASES")
+				if err != nil {
+					return err
+				}
+				if !slices.ContainsFunc(databases, func(row []string) bool { return row[0] == db_name }) {
+					skipDatabase = "database " + db_name + " doesn't exist"
+				}
+			}
+			var err error
+			file, err = archiveSite(chosenSite, config.BackupsDir, config.BackupFormat, skipDatabase)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + file.Path)
+		if file.DatabaseSkipped != "" {
+			report(skip, "No database in the backup, "+file.DatabaseSkipped)
+		}
+	}
+
+	if hasCompose {
+		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" stop
+		err := step("Stopping containers", "Stopped containers", func() error {
+			_, err := command("docker", "compose", "-f", composeFile, "stop").Step("Stop containers")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		err = step("Removing containers and volumes", "Removed containers and volumes", func() error {
+			_, err := command("docker", "compose", "-f", composeFile, "down", "-v").Step("Remove containers")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		report(skip, "No containers, "+composeFile+" is gone")
+	}
+
+	if ownDatabase {
+		err := step("Dropping database", "Dropped database "+db_name, func() error {
+			_, err := mariadbQuery("DROP DATABASE IF EXISTS $DB_NAME;", "DB_NAME="+db_name).Step("Drop database")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		err = step("Dropping database user", "Dropped user "+db_user, func() error {
+			_, err := mariadbQuery("DROP USER IF EXISTS '$DB_USER'@'%';", "DB_USER="+db_user).Step("Drop database user")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		report(skip, "Database is on another server, not dropped")
+	}
+
+	err = step("Removing image backups", "Removed "+imageBackups, func() error {
+		_, err := sudoCommand("rm", "-rf", imageBackups).Step("Remove image backups")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// remove site folder
+	err = step("Removing site folder", "Removed "+siteDir, func() error {
+		_, err := sudoCommand("rm", "-rf", siteDir).Step("Remove site folder")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	printInBox("Deleted " + chosenSite + ". Have a fresh day!")
+	return nil
+}
+
+var addSSHKeyArgs struct {
+	key string
+}
+
+func addSSHKeyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&addSSHKeyArgs.key, "key", "", "public key to add")
+}
+
+func addSSHKey() error {
+	key := addSSHKeyArgs.key
+	err := prompt(huh.NewText().
 		Title("Enter public key").
 		Description("Look in ~/.ssh - file ends in .pub").
 		Validate(func(s string) error {
@@ -398,118 +664,85 @@ func addSSHKey() {
 			}
 			return nil
 		}).
-		Value(&key).
-		Run()
+		Value(&key))
+	if err != nil {
+		return err
+	}
 
 	if key == "" {
-		buhBye()
+		return missing("key")
 	}
 
-	err := AppendToFile("/home/"+USER+"/.ssh/authorized_keys", key)
+	authorizedKeys := "/home/" + USER + "/.ssh/authorized_keys"
+	err = do("append key to "+authorizedKeys, func() error {
+		return AppendToFile(authorizedKeys, key)
+	})
 	if err != nil {
-		log.Fatal(err)
+		return stepFailed("Add key to "+authorizedKeys, err)
 	}
 
 	printInBox("Added SSH key. Have a nice day!")
+	return nil
 }
 
-func containerShell() {
+func containerShell() error {
 	notice := lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(fmt.Sprintf("Connecting shell for %s...", chosenSite))
 	fmt.Println(notice)
-	cmd := exec.Command("docker", "exec", "-it", chosenSite, "ash")
+	cmd := command("docker", "exec", "-it", chosenSite, "ash")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	err := cmd.Run()
-	checkError(err, "Could not spawn shell")
+	if err := cmd.RunStep("Spawn shell"); err != nil {
+		return err
+	}
 	printInBox("Have a magnificent day!")
+	return nil
 }
 
-func fail2banStatus() {
-	// docker exec fail2ban sh -c "fail2ban-client status | sed -n 's/,//g;s/.*Jail list://p' | xargs -n1 fail2ban-client status"
-	cmd := exec.Command("docker", "exec", "fail2ban", "sh", "-c", "fail2ban-client status | sed -n 's/,//g;s/.*Jail list://p' | xargs -n1 fail2ban-client status")
-	output, err := cmd.CombinedOutput()
-	checkError(err, string(output))
-	printInBox(string(output))
-}
-
-func unbanIp() {
-	var ip string
-	huh.NewInput().
-		Title("Enter IP to unban").
-		Validate(func(s string) error {
-			if s == "" {
-				return fmt.Errorf("IP address cannot be empty")
-			}
-			return nil
-		}).
-		Value(&ip).
-		Run()
-
-	spinner.New().Title("Unbanning IP...").Action(func() {
-		// docker exec fail2ban sh -c "fail2ban-client status | grep 'Jail list'" | sed -E 's/^[^:]+:[ \t]+//' | sed 's/,//g'
-		jails, err := exec.Command("docker", "exec", "fail2ban", "sh", "-c", "fail2ban-client status | grep 'Jail list' | sed -E 's/^[^:]+:[ \t]+//' | sed 's/,//g'").Output()
-		checkError(err, string(jails))
-		jailsSlice := strings.Fields(string(jails))
-
-		for _, part := range jailsSlice {
-			err = exec.Command("docker", "exec", "fail2ban", "sh", "-c", fmt.Sprintf("fail2ban-client set %s unbanip %s", part, ip)).Run()
-			checkError(err, "Error unbanning IP address")
-		}
-	}).Run()
-
-	printInBox(fmt.Sprintf("Unbanned %s. Don't forget to whitelist and have a super day!", ip))
-}
-
-func whitelistIp() {
-	var ip string
-	huh.NewInput().
-		Title("Enter IP to whitelist").
-		Validate(func(s string) error {
-			if s == "" {
-				return fmt.Errorf("IP address cannot be empty")
-			}
-			return nil
-		}).
-		Value(&ip).
-		Run()
-
-	getSudo()
-
-	// sudo sed -i "s|ignoreip =.*|& $whitelistip|" ~/server/fail2ban/data/jail.d/jail.local
-	cmd := exec.Command("sudo", "sed", "-i", fmt.Sprintf("s|ignoreip =.*|& %s|", ip), "/home/"+USER+"/server/fail2ban/data/jail.d/jail.local")
-	output, err := cmd.CombinedOutput()
-	checkError(err, string(output))
-	// docker exec fail2ban sh -c "fail2ban-client reload"
-	cmd = exec.Command("docker", "exec", "fail2ban", "sh", "-c", "fail2ban-client reload")
-	output, err = cmd.CombinedOutput()
-	checkError(err, string(output))
-	printInBox(fmt.Sprintf("Whitelisted %s. Have a super day!", ip))
-}
-
-func pruneDockerImages() {
+func pruneDockerImages() error {
 	var output []byte
-	var err error
 	// spinner
-	spinner.New().Title("Pruning docker images...").Action(func() {
+	err := spin("Pruning docker images...", func() error {
 		// docker image prune -af
-		cmd := exec.Command("docker", "image", "prune", "-af")
-		output, err = cmd.CombinedOutput()
-		checkError(err, string(output))
-	}).Run()
+		var err error
+		output, err = command("docker", "image", "prune", "-af").Step("Prune images")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	printInBox(fmt.Sprintf("%s\nPruned docker images. Have a super day!", string(output)))
+	return nil
 }
 
-func mariadbUpgrade() {
+func mariadbUpgrade() error {
 	// docker exec mariadb sh -c 'mysql_upgrade -uroot -p"$MYSQL_ROOT_PASSWORD"'
-	cmd := exec.Command("docker", "exec", "mariadb", "sh", "-c", "mysql_upgrade -uroot -p\"$MYSQL_ROOT_PASSWORD\"")
-	output, err := cmd.CombinedOutput()
-	checkError(err, string(output))
+	output, err := command("docker", "exec", "mariadb", "sh", "-c", "mysql_upgrade -uroot -p\"$MYSQL_ROOT_PASSWORD\"").Step("Upgrade MariaDB")
+	if err != nil {
+		return err
+	}
 	printInBox(fmt.Sprintf("%s\nHave a fabulous day!", string(output)))
+	return nil
+}
+
+var databaseSearchReplaceArgs struct {
+	search  string
+	replace string
+}
+
+func databaseSearchReplaceFlags(fs *flag.FlagSet) {
+	fs.StringVar(&databaseSearchReplaceArgs.search, "search", "", "string to search for")
+	fs.StringVar(&databaseSearchReplaceArgs.replace, "replace", "", "replacement string")
 }
 
-func databaseSearchReplace() {
-	var search string
-	var replace string
+// wpSearchReplace replaces a string in every table of a site's database.
+// The strings are passed to wp-cli as arguments, so no shell sees them.
+func wpSearchReplace(site, search, replace string) *Cmd {
+	return command("docker", "exec", "-w", "/usr/src/wordpress", site, "wp", "search-replace", search, replace, "--all-tables")
+}
+
+func databaseSearchReplace() error {
+	search := databaseSearchReplaceArgs.search
+	replace := databaseSearchReplaceArgs.replace
 
 	form := huh.NewForm(
 		huh.NewGroup(
@@ -536,47 +769,65 @@ func databaseSearchReplace() {
 				Value(&replace),
 		),
 	)
-	form.Run()
+	if err := prompt(form); err != nil {
+		return err
+	}
 
 	if search == "" || replace == "" {
-		buhBye()
+		return missing("search", "replace")
+	}
+	// wp-cli would read them as options
+	if strings.HasPrefix(search, "-") || strings.HasPrefix(replace, "-") {
+		return &UsageError{"search and replace strings can't start with -"}
 	}
 
 	var output []byte
-	var err error
-	spinner.New().Title("Searching and replacing...").Action(func() {
-		cmd := exec.Command("docker", "exec", chosenSite, "sh", "-c", fmt.Sprintf("cd /usr/src/wordpress && wp search-replace '%s' '%s' --all-tables", search, replace))
-		output, err = cmd.CombinedOutput()
-	}).Run()
+	err := spin("Searching and replacing...", func() error {
+		var err error
+		output, err = wpSearchReplace(chosenSite, search, replace).Step("Search and replace")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	checkError(err, string(output))
 	printInBox(fmt.Sprintf("%s\n\nHave a radical day!", string(output)))
+	return nil
+}
+
+var changeSiteDomainArgs = struct {
+	domain     string
+	selfSigned bool
+}{selfSigned: true}
+
+func changeSiteDomainFlags(fs *flag.FlagSet) {
+	fs.StringVar(&changeSiteDomainArgs.domain, "domain", "", "new domain(s), separated with a space")
+	fs.BoolVar(&changeSiteDomainArgs.selfSigned, "self-signed", true, "use a self-signed certificate (false generates one)")
 }
 
-func changeSiteDomain() {
+func changeSiteDomain() error {
+	composeFile := "/home/" + USER + "/sites/" + chosenSite + "/docker-compose.yml"
+
 	// get current site
-	// yq '.services.wordpress.labels.caddy' "/home/$CUR_USER/sites/$sitename/docker-compose.yml"
-	output, err := exec.Command("yq", ".services.wordpress.labels.caddy", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml").CombinedOutput()
-	checkError(err, string(output))
+	compose, err := ReadComposeFile(composeFile)
+	if err != nil {
+		return stepFailed("Read current domain", err)
+	}
+	currentDomain, _ := compose.Label("wordpress", "caddy")
 
-	var newDomain string
-	useSelfSigned := true
+	newDomain := changeSiteDomainArgs.domain
+	useSelfSigned := changeSiteDomainArgs.selfSigned
 
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewNote().
 				Title("Change Domain").
-				Description("This will change the domain(s) in Caddy\nCurrent domain(s): "+lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(string(output))),
+				Description("This will change the domain(s) in Caddy\nCurrent domain(s): "+lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(currentDomain)),
 
 			huh.NewInput().
 				Title("Enter new domain").
 				Description("Separate domains with a space.").
-				Validate(func(s string) error {
-					if s == "" {
-						return fmt.Errorf("domain cannot be empty")
-					}
-					return nil
-				}).
+				Validate(ValidateDomains).
 				Value(&newDomain),
 
 			huh.NewConfirm().
@@ -587,49 +838,62 @@ func changeSiteDomain() {
 				Value(&useSelfSigned),
 		),
 	)
-	form.Run()
+	if err := prompt(form); err != nil {
+		return err
+	}
 
 	if newDomain == "" {
-		buhBye()
-	}
-
-	spinner.New().Title("Changing domain...").Action(func() {
-		// update caddy tls option
-		if useSelfSigned {
-			// yq -i '.services.wordpress.labels."caddy.tls" = "internal"' "/home/$CUR_USER/sites/$sitename/docker-compose.yml"
-			cmd := exec.Command("yq", "-i", ".services.wordpress.labels.\"caddy.tls\" = \"internal\"", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml")
-			output, err := cmd.CombinedOutput()
-			checkError(err, string(output))
-		} else {
-			// yq -i 'del(.services.wordpress.labels."caddy.tls")' "/home/$CUR_USER/sites/$sitename/docker-compose.yml"
-			cmd := exec.Command("yq", "-i", "del(.services.wordpress.labels.\"caddy.tls\")", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml")
-			output, err := cmd.CombinedOutput()
-			checkError(err, string(output))
-		}
+		return missing("domain")
+	}
+	if err := ValidateDomains(newDomain); err != nil {
+		return &UsageError{err.Error()}
+	}
 
-		// update caddy domain
-		// yq -i ".services.wordpress.labels.caddy = \"$newdomain\"" "/home/$CUR_USER/sites/$sitename/docker-compose.yml"
-		cmd := exec.Command("yq", "-i", fmt.Sprintf(".services.wordpress.labels.caddy = \"%s\"", newDomain), "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml")
-		output, err = cmd.CombinedOutput()
-		checkError(err, string(output))
+	// keep the original so a failed edit can be restored
+	original, err := os.ReadFile(composeFile)
+	if err != nil {
+		return stepFailed("Read docker-compose.yml", err)
+	}
+	var undo undoStack
+
+	err = spin("Changing domain...", func() error {
+		undo.push("Restored "+composeFile, func() error {
+			return do("restore "+composeFile, func() error {
+				return WriteFileAtomic(composeFile, original)
+			})
+		})
+
+		// update caddy domain and tls option
+		err := setCaddyLabels(composeFile, newDomain, &useSelfSigned)
+		if err != nil {
+			return stepFailed("Update docker-compose.yml", err)
+		}
 
 		// reload site
-		cmd = exec.Command("docker", "compose", "-f", "/home/"+USER+"/sites/"+chosenSite+"/docker-compose.yml", "up", "-d")
-		output, err = cmd.CombinedOutput()
-		checkError(err, string(output))
-
-	}).Run()
-	checkError(err, string(output))
+		_, err = command("docker", "compose", "-f", composeFile, "up", "-d").Step("Reload site")
+		return err
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
 
 	printInBox("Domain updated. Have a tubular day!")
+	return nil
+}
 
+var generateSshKeyArgs struct {
+	passphrase string
 }
 
-func generateSshKey() {
+func generateSshKeyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&generateSshKeyArgs.passphrase, "passphrase", "", "passphrase for a new key")
+}
+
+func generateSshKey() error {
 	const file = "/root/.ssh/id_ed25519"
 
 	printKey := func() {
-		publicKey, _ := exec.Command("sudo", "cat", file+".pub").Output()
+		publicKey, _ := sudoCommand("cat", file+".pub").ReadOnly().Output()
 		trimmedKey := strings.TrimSpace(string(publicKey))
 		msg := fmt.Sprintf("Public key:\n\n%s", trimmedKey)
 		err := clipboard.WriteAll(trimmedKey)
@@ -640,40 +904,66 @@ func generateSshKey() {
 	}
 
 	// test if file exists
-	if err := exec.Command("sudo", "test", "-s", file).Run(); err == nil {
+	if err := sudoCommand("test", "-s", file).ReadOnly().Run(); err == nil {
 		printKey()
-		return
+		return nil
 	}
 
-	var passphrase string
-	huh.NewInput().
+	passphrase := generateSshKeyArgs.passphrase
+	err := prompt(huh.NewInput().
 		Title("Enter passphrase").
 		Password(true).
-		Value(&passphrase).
-		Run()
+		Value(&passphrase))
+	if err != nil {
+		return err
+	}
 
-	err := exec.Command("sudo", "ssh-keygen", "-t", "ed25519", "-N", passphrase, "-f", file).Run()
-	checkError(err, "Failed to create SSH key.")
+	_, err = sudoCommand("ssh-keygen", "-t", "ed25519", "-N", passphrase, "-f", file).WithSecrets(passphrase).Step("Create SSH key")
+	if err != nil {
+		return err
+	}
 
 	printKey()
+	return nil
+}
+
+var migrateFilesArgs = struct {
+	host            string
+	path            string
+	exclude         stringList
+	defaultExcludes bool
+	verify          bool
+}{defaultExcludes: true, verify: true}
+
+func migrateFilesFlags(fs *flag.FlagSet) {
+	fs.StringVar(&migrateFilesArgs.host, "host", "", "source host from /root/.ssh/config")
+	fs.StringVar(&migrateFilesArgs.path, "path", "", "full source path or file")
+	fs.Var(&migrateFilesArgs.exclude, "exclude", "rsync exclude pattern, can be repeated")
+	fs.BoolVar(&migrateFilesArgs.defaultExcludes, "default-excludes", true, "skip "+strings.Join(defaultMigrateExcludes, ", "))
+	fs.BoolVar(&migrateFilesArgs.verify, "verify", true, "compare checksums after the transfer")
 }
 
-func migrateFiles() {
+func migrateFiles() error {
 	hosts, err := GetHostsFromSSHConfig("/root/.ssh/config", true)
 	if err != nil || len(hosts) == 0 {
-		printInBox("No hosts found in SSH config.\n\nPlease add to /root/.ssh/config and try again.")
-		os.Exit(0)
+		return stepFailed("Read SSH config", fmt.Errorf("no hosts found in SSH config.\n\nPlease add to /root/.ssh/config and try again"))
 	}
 
-	var sourceHost string
-	var sourcePath string
+	sourceHost := migrateFilesArgs.host
+	sourcePath := migrateFilesArgs.path
+	verify := migrateFilesArgs.verify
+	var excludes []string
+	if migrateFilesArgs.defaultExcludes {
+		excludes = append(excludes, defaultMigrateExcludes...)
+	}
+	excludes = append(excludes, migrateFilesArgs.exclude...)
 	var destination = "/home/" + USER + "/sites/" + chosenSite + "/wordpress/"
 	form := huh.NewForm(
 		huh.NewGroup(
 			// select from hosts
 			huh.NewSelect[string]().
 				Title("Select source host").
-				Options(huh.NewOptions(hosts...)...).
+				Options(sshHostOptions(hosts)...).
 				Value(&sourceHost),
 
 			// enter source path
@@ -686,99 +976,145 @@ func migrateFiles() {
 					return nil
 				}).
 				Value(&sourcePath),
+
+			// skip folders that don't need copying
+			huh.NewMultiSelect[string]().
+				Title("Skip").
+				Options(huh.NewOptions(defaultMigrateExcludes...)...).
+				Value(&excludes),
+
+			huh.NewConfirm().
+				Title("Compare checksums after the transfer").
+				Value(&verify),
 		),
 	)
-	form.Run()
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if sourceHost == "" || !strings.HasPrefix(sourcePath, "/") {
+		return missing("host", "path")
+	}
+	if err := checkSSHHost(hosts, sourceHost); err != nil {
+		return err
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
 
-	// make sure there's a trailing slash if the source path is not a file
-	if !strings.HasSuffix(sourcePath, "/") && !strings.Contains(sourcePath, ".") {
-		sourcePath += "/"
+	// copy the contents of folders, not the folder itself
+	kind, err := RemotePathType(sourceHost, sourcePath)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "missing":
+		return stepFailed("Check source path", fmt.Errorf("%s not found on %s", sourcePath, sourceHost))
+	case "dir":
+		sourcePath = strings.TrimSuffix(sourcePath, "/") + "/"
+	case "file":
+		sourcePath = strings.TrimSuffix(sourcePath, "/")
 	}
 
 	// confirm options
-	var confirm bool
-	huh.NewConfirm().
-		Title("Everything look good?").
-		Description(fmt.Sprintf("Source host: %s\nSource path: %s\nDestination: %s", sourceHost, sourcePath, destination)).
-		Value(&confirm).
-		Run()
+	var confirmed bool
+	confirm(
+		"Everything look good?",
+		fmt.Sprintf("Source host: %s\nSource path: %s\nDestination: %s\nSkipping: %s", sourceHost, sourcePath, destination, orDash(strings.Join(excludes, ", "))),
+		&confirmed,
+	)
 
-	if !confirm {
-		buhBye()
+	if !confirmed {
+		return declined()
 	}
 
-	// rsync
-	cmd := exec.Command("sudo", "rsync", "-rtp", "--progress", sourceHost+":"+sourcePath, destination)
-	cmd.Stdout = os.Stdout
-	cmd.Stdin = os.Stdin
-	err = cmd.Run()
-	if err != nil {
-		checkError(err, "Error migrating files:\n\n"+err.Error())
+	if err := rsyncFromHost(sourceHost+":"+sourcePath, destination, excludes, verify); err != nil {
+		return err
 	}
 
 	// fix permissions
-	spinner.New().Title(fmt.Sprintf("Fixing permissions for %s...", chosenSite)).Action(runFixPermissions).Run()
+	err = spin(fmt.Sprintf("Fixing permissions for %s...", chosenSite), runFixPermissions)
+	if err != nil {
+		return err
+	}
 
 	printInBox("Files migrated. Have a splendid day!")
+	return nil
 }
 
-func optimizeImages() {
+func optimizeImages() error {
 	var dir = "/home/" + USER + "/sites/" + chosenSite
 	// confirm options
-	var confirm bool
-	huh.NewConfirm().
-		Title(fmt.Sprintf("Optimize images in %s?", dir)).
-		Description("This only needs to be done immediately after migration if images are unoptimized. New images are optimized automatically.").
-		Value(&confirm).
-		Run()
+	var confirmed bool
+	confirm(
+		fmt.Sprintf("Optimize images in %s?", dir),
+		"This only needs to be done immediately after migration if images are unoptimized. New images are optimized automatically.",
+		&confirmed,
+	)
 
-	if !confirm {
-		buhBye()
+	if !confirmed {
+		return declined()
 	}
 
 	// rsync
-	cmd := exec.Command("sudo", "docker", "run", "--rm", "-v", dir+":/images", "-v", "/root/image-backups/"+chosenSite+":/backup", "-e", "MIN_SIZE=900", "-e", "MAX_HEIGHT=2500", "-e", "MAX_WIDTH=2500", "-e", "JOBS=2", "henrygd/optimize")
+	cmd := sudoCommand("docker", "run", "--rm", "-v", dir+":/images", "-v", "/root/image-backups/"+chosenSite+":/backup", "-e", "MIN_SIZE=900", "-e", "MAX_HEIGHT=2500", "-e", "MAX_WIDTH=2500", "-e", "JOBS=2", "henrygd/optimize")
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
-	err := cmd.Run()
-	if err != nil {
-		checkError(err, "Error optimizing images:\n\n"+err.Error())
-	}
+	return cmd.RunStep("Optimize images")
 }
 
 // imports last modified sql file in site directory
-func importWPDatabase() {
+func importWPDatabase() error {
 	file, err := FindLastModifiedFile("/home/"+USER+"/sites/"+chosenSite+"/wordpress", ".sql")
 	if err != nil {
-		checkError(err, err.Error())
+		return stepFailed("Find .sql file", err)
 	}
 
 	// ask for confirmation
-	confirm := true
-	huh.NewConfirm().
-		Title("Are you sure you want to import this database?\nThis will overwrite the current database.\n").
-		Description(fmt.Sprintf("Site: %s\nFile: %s", chosenSite, file.Name())).
-		Value(&confirm).
-		Run()
+	confirmed := true
+	confirm(
+		"Are you sure you want to import this database?\nThis will overwrite the current database.\n",
+		fmt.Sprintf("Site: %s\nFile: %s", chosenSite, file.Name()),
+		&confirmed,
+	)
 
-	if !confirm {
-		buhBye()
+	if !confirmed {
+		return declined()
 	}
 
 	var output []byte
-	spinner.New().Title(fmt.Sprintf("Importing database for %s...", chosenSite)).Action(func() {
-		cmd := exec.Command("docker", "exec", chosenSite, "sh", "-c", "cd /usr/src/wordpress && wp db import "+file.Name())
-		output, err = cmd.CombinedOutput()
-	}).Run()
-	checkError(err, string(output))
+	err = spin(fmt.Sprintf("Importing database for %s...", chosenSite), func() error {
+		var err error
+		output, err = command("docker", "exec", chosenSite, "sh", "-c", "cd /usr/src/wordpress && wp db import "+file.Name()).Step("Import database")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	printInBox(fmt.Sprintf("%s\nHave a grand day!", string(output)))
+	return nil
 }
 
-func changeDatabaseInfo() {
-	var db_name string
-	var db_user string
-	var db_pass string
-	var db_host = "mariadb"
+var changeDatabaseInfoArgs = struct {
+	name string
+	user string
+	pass string
+	host string
+}{host: "mariadb"}
+
+func changeDatabaseInfoFlags(fs *flag.FlagSet) {
+	fs.StringVar(&changeDatabaseInfoArgs.name, "db-name", "", "database name")
+	fs.StringVar(&changeDatabaseInfoArgs.user, "db-user", "", "database user")
+	fs.StringVar(&changeDatabaseInfoArgs.pass, "db-password", "", "database password")
+	fs.StringVar(&changeDatabaseInfoArgs.host, "db-host", "mariadb", "database host")
+}
+
+func changeDatabaseInfo() error {
+	db_name := changeDatabaseInfoArgs.name
+	db_user := changeDatabaseInfoArgs.user
+	db_pass := changeDatabaseInfoArgs.pass
+	db_host := changeDatabaseInfoArgs.host
 
 	notEmpty := func(s string) error {
 		if s == "" {
@@ -812,10 +1148,12 @@ func changeDatabaseInfo() {
 		),
 	)
 
-	form.Run()
+	if err := prompt(form); err != nil {
+		return err
+	}
 
 	if db_name == "" || db_user == "" || db_pass == "" || db_host == "" {
-		buhBye()
+		return missing("db-name", "db-user", "db-password", "db-host")
 	}
 
 	filePath := "/home/" + USER + "/sites/" + chosenSite + "/wordpress/wp-config.php"
@@ -828,20 +1166,31 @@ func changeDatabaseInfo() {
 
 	err := UpdateDefineValues(filePath, updates)
 	if err != nil {
-		checkError(err, err.Error())
+		return stepFailed("Update wp-config.php", err)
 	}
 
 	printInBox("Database config updated. Have a marvelous day!")
+	return nil
+}
+
+var maintenanceModeArgs struct {
+	enable bool
+}
+
+func maintenanceModeFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&maintenanceModeArgs.enable, "enable", false, "enable maintenance mode (disables when omitted)")
 }
 
-func maintenanceMode() {
-	var enable bool
-	huh.NewConfirm().
+func maintenanceMode() error {
+	enable := maintenanceModeArgs.enable
+	err := prompt(huh.NewConfirm().
 		Title("Maintenance mode for " + chosenSite).
 		Value(&enable).
 		Affirmative("Enable").
-		Negative("Disable").
-		Run()
+		Negative("Disable"))
+	if err != nil {
+		return err
+	}
 
 	action := "deactivate"
 	if enable {
@@ -849,39 +1198,43 @@ func maintenanceMode() {
 	}
 
 	var output []byte
-	var err error
-	spinner.New().Title(fmt.Sprintf("Changing maintenance mode for %s...", chosenSite)).Action(func() {
-		cmd := exec.Command("docker", "exec", chosenSite, "sh", "-c", "cd /usr/src/wordpress && wp maintenance-mode "+action)
-		output, err = cmd.CombinedOutput()
-	}).Run()
+	err = spin(fmt.Sprintf("Changing maintenance mode for %s...", chosenSite), func() error {
+		var err error
+		output, err = command("docker", "exec", chosenSite, "sh", "-c", "cd /usr/src/wordpress && wp maintenance-mode "+action).Step("Change maintenance mode")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	checkError(err, string(output))
 	printInBox(fmt.Sprintf("%s\nHave a brilliant day!", string(output)))
+	return nil
+}
 
+// renderStatusPercentage colors a percentage green, yellow above
+// levels[0] and red above levels[1].
+func renderStatusPercentage(v float64, levels [2]float64) string {
+	style := lipgloss.NewStyle()
+	colors := map[string]string{
+		"red":    "160",
+		"green":  "42",
+		"yellow": "220",
+	}
+	color := "green"
+	switch {
+	case v > levels[1]:
+		color = "red"
+	case v > levels[0]:
+		color = "yellow"
+	}
+	return style.Foreground(lipgloss.Color(colors[color])).Render(fmt.Sprintf("%.2f%%", v))
 }
 
-func serverStatus() {
+func serverStatus() error {
 	convertToGigabytes := func(v float64) string {
 		return fmt.Sprintf("%.2f GB", v/1024/1024/1024)
 	}
 
-	renderStatusPercentage := func(v float64, levels [2]float64) string {
-		style := lipgloss.NewStyle()
-		colors := map[string]string{
-			"red":    "160",
-			"green":  "42",
-			"yellow": "220",
-		}
-		color := "green"
-		switch {
-		case v > levels[1]:
-			color = "red"
-		case v > levels[0]:
-			color = "yellow"
-		}
-		return style.Foreground(lipgloss.Color(colors[color])).Render(fmt.Sprintf("%.2f%%", v))
-	}
-
 	coreCount, _ := cpu.Counts(true)
 	loadAvg, _ := load.Avg()
 	virtualMemory, _ := mem.VirtualMemory()
@@ -915,4 +1268,19 @@ func serverStatus() {
 	fmt.Fprintln(&sb, "Percent: ", renderStatusPercentage(usage.UsedPercent, [2]float64{60, 75}))
 
 	printInBox(strings.TrimSpace(sb.String()))
+
+	// docker stats takes a moment to sample CPU usage
+	var stats []ContainerStats
+	err := spin("Reading container usage...", func() error {
+		var err error
+		stats, err = GetContainerStats()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(stats) > 0 {
+		fmt.Println(renderContainerStats(GroupContainerStats(stats), coreCount))
+	}
+	return nil
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func setCreateSiteArgs(t *testing.T, name, domain string, db bool) {
+	t.Helper()
+	old := createSiteArgs
+	t.Cleanup(func() { createSiteArgs = old })
+	createSiteArgs.name = name
+	createSiteArgs.domain = domain
+	createSiteArgs.php7 = false
+	createSiteArgs.db = db
+	createSiteArgs.templateSource = ""
+	createSiteArgs.templateChecksums = ""
+}
+
+func TestCreateSite(t *testing.T) {
+	r := &fakeRunner{}
+	home := useFakeRunner(t, r)
+	setCreateSiteArgs(t, "shop", "shop.com www.shop.com", true)
+
+	if err := createSite(); err != nil {
+		t.Fatal(err)
+	}
+	siteDir := home + "/sites/shop"
+	assertRanInOrder(t, r,
+		"sudo -v",
+		"# mkdir -p "+siteDir+"/wordpress",
+		"# write "+siteDir+"/docker-compose.yml",
+		"# write "+siteDir+"/.template-version",
+		"# set caddy label to shop.com www.shop.com",
+		"docker compose -f "+siteDir+"/docker-compose.yml create",
+		"sudo chown nobody: "+siteDir+"/wordpress",
+		"DB_NAME=shop mariadb bash -c mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"CREATE DATABASE",
+		"CREATE USER",
+		"GRANT ALL PRIVILEGES",
+	)
+	if r.ran("DROP") || r.ran("rm -r") {
+		t.Errorf("rolled back a successful create:\n%v", r.commands)
+	}
+}
+
+func TestCreateSiteWithoutDatabase(t *testing.T) {
+	r := &fakeRunner{}
+	useFakeRunner(t, r)
+	setCreateSiteArgs(t, "static", "static.com", false)
+
+	if err := createSite(); err != nil {
+		t.Fatal(err)
+	}
+	if r.ran("mariadb") {
+		t.Errorf("created a database with --db=false:\n%v", r.commands)
+	}
+}
+
+func TestCreateSiteInvalidInput(t *testing.T) {
+	tests := []struct {
+		name, site, domain string
+	}{
+		{"path in name", "../etc", "a.com"},
+		{"missing domain", "shop", ""},
+		{"invalid domain", "shop", "a.com;reboot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &fakeRunner{}
+			useFakeRunner(t, r)
+			setCreateSiteArgs(t, tt.site, tt.domain, true)
+
+			var usage *UsageError
+			if err := createSite(); !errors.As(err, &usage) {
+				t.Fatalf("got %v, want a usage error", err)
+			}
+			if len(r.commands) > 0 {
+				t.Errorf("ran commands for invalid input:\n%v", r.commands)
+			}
+		})
+	}
+}
+
+func TestCreateSiteRollback(t *testing.T) {
+	r := &fakeRunner{fail: "GRANT ALL PRIVILEGES"}
+	home := useFakeRunner(t, r)
+	setCreateSiteArgs(t, "shop", "shop.com", true)
+
+	err := createSite()
+	var rollback *RollbackError
+	if !errors.As(err, &rollback) {
+		t.Fatalf("got %v, want a rollback", err)
+	}
+	var step *StepError
+	if !errors.As(err, &step) || step.Step != "Grant database privileges" {
+		t.Errorf("got %v, want the failed grant", err)
+	}
+	if len(rollback.Failed) > 0 {
+		t.Errorf("undo failed: %v", rollback.Failed)
+	}
+
+	siteDir := home + "/sites/shop"
+	wantUndone := []string{
+		"Dropped user u_shop",
+		"Dropped database shop",
+		"Restored owner of " + siteDir + "/wordpress",
+		"Removed containers",
+	}
+	if len(rollback.Undone) < len(wantUndone) || !slices.Equal(rollback.Undone[:len(wantUndone)], wantUndone) {
+		t.Errorf("undone %v, want it to start with %v", rollback.Undone, wantUndone)
+	}
+	if last := rollback.Undone[len(rollback.Undone)-1]; last != "Removed "+siteDir {
+		t.Errorf("last undo is %q, want the site folder removed", last)
+	}
+
+	// undo runs in reverse after the failed step
+	assertRanInOrder(t, r,
+		"GRANT ALL PRIVILEGES",
+		"DROP USER IF EXISTS",
+		"DROP DATABASE IF EXISTS",
+		"sudo chown "+USER+": "+siteDir+"/wordpress",
+		"docker compose -f "+siteDir+"/docker-compose.yml rm -f",
+		"# remove "+siteDir+"/.template-version",
+		"sudo rm -r "+siteDir,
+	)
+}
+
+func TestCreateSiteExisting(t *testing.T) {
+	r := &fakeRunner{}
+	home := useFakeRunner(t, r)
+	setCreateSiteArgs(t, "shop", "shop.com", true)
+	writeTestFile(t, home+"/sites/shop/docker-compose.yml", "services: {}\n")
+
+	err := createSite()
+	var step *StepError
+	if !errors.As(err, &step) || step.Step != "Create directory" {
+		t.Fatalf("got %v, want the existing folder refused", err)
+	}
+	// nothing was done, so nothing is undone, least of all the folder
+	if r.ran("rm ") {
+		t.Errorf("removed the existing site:\n%v", r.commands)
+	}
+}
+
+// writeTestSite writes a site with a compose file and a wp-config.php that
+// uses dbName on dbHost.
+func writeTestSite(t *testing.T, home, site, dbName, dbHost string) {
+	t.Helper()
+	writeTestFile(t, home+"/sites/"+site+"/docker-compose.yml", "services:\n  wordpress:\n    labels:\n      caddy: "+site+".com\n")
+	writeTestFile(t, home+"/sites/"+site+"/wordpress/wp-config.php",
+		"<?php\ndefine('DB_NAME', '"+dbName+"');\ndefine('DB_USER', 'u_"+dbName+"');\ndefine('DB_HOST', '"+dbHost+"');\n")
+}
+
+func deleteTestSite(t *testing.T, site string, backup bool) error {
+	t.Helper()
+	oldSite, oldArgs := chosenSite, deleteSiteArgs
+	t.Cleanup(func() { chosenSite, deleteSiteArgs = oldSite, oldArgs })
+	chosenSite = site
+	deleteSiteArgs.backup = backup
+	return deleteSite()
+}
+
+func TestDeleteSite(t *testing.T) {
+	r := &fakeRunner{outputs: map[string]string{"SHOW DATABASES": "mysql\nshop_db\n"}}
+	home := useFakeRunner(t, r)
+	writeTestSite(t, home, "shop", "shop_db", "mariadb")
+
+	if err := deleteTestSite(t, "shop", true); err != nil {
+		t.Fatal(err)
+	}
+	siteDir := home + "/sites/shop"
+	assertRanInOrder(t, r,
+		"sudo -v",
+		"mariadb-dump",
+		"sudo tar -c --gzip",
+		"docker compose -f "+siteDir+"/docker-compose.yml stop",
+		"docker compose -f "+siteDir+"/docker-compose.yml down -v",
+		"DB_NAME=shop_db mariadb bash -c mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"DROP DATABASE",
+		"DB_USER=u_shop_db mariadb bash -c mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \"DROP USER",
+		"sudo rm -rf /root/image-backups/shop",
+		"sudo rm -rf "+siteDir,
+	)
+}
+
+func TestDeleteSiteAfterDroppedDatabase(t *testing.T) {
+	// a delete that failed after dropping the database runs again
+	r := &fakeRunner{outputs: map[string]string{"SHOW DATABASES": "mysql\n"}}
+	home := useFakeRunner(t, r)
+	writeTestSite(t, home, "shop", "shop_db", "mariadb")
+
+	if err := deleteTestSite(t, "shop", true); err != nil {
+		t.Fatal(err)
+	}
+	if r.ran("mariadb-dump") {
+		t.Errorf("dumped a database that is gone:\n%v", r.commands)
+	}
+	assertRanInOrder(t, r, "sudo tar -c", "down -v", "DROP DATABASE IF EXISTS", "sudo rm -rf "+home+"/sites/shop")
+}
+
+func TestDeleteSiteRemoteDatabase(t *testing.T) {
+	r := &fakeRunner{}
+	home := useFakeRunner(t, r)
+	writeTestSite(t, home, "shop", "shop_db", "db.example.com")
+
+	if err := deleteTestSite(t, "shop", true); err != nil {
+		t.Fatal(err)
+	}
+	if r.ran("mariadb-dump") || r.ran("DROP") {
+		t.Errorf("touched a database on another server:\n%v", r.commands)
+	}
+	assertRanInOrder(t, r, "sudo tar -c", "down -v", "sudo rm -rf "+home+"/sites/shop")
+}
+
+func TestDeleteSiteStopsOnFailure(t *testing.T) {
+	r := &fakeRunner{fail: "down -v"}
+	home := useFakeRunner(t, r)
+	writeTestSite(t, home, "shop", "shop_db", "mariadb")
+
+	if err := deleteTestSite(t, "shop", false); err == nil {
+		t.Fatal("delete succeeded with a failed step")
+	}
+	if r.ran("DROP") || r.ran("rm -rf") {
+		t.Errorf("kept deleting after a failed step:\n%v", r.commands)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/huh/spinner"
+)
+
+// true when running as a subcommand - values come from flags instead of prompts
+var scripted bool
+
+// answer for confirmation prompts when scripted
+var assumeYes bool
+
+// true when an action should run for every site instead of chosenSite
+var allSites bool
+
+// value of the "All sites" choice in the menu
+const allSitesChoice = "\x00all"
+
+// allSitesFlag adds --all for options that can run for every site.
+func allSitesFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&allSites, "all", false, "run for all sites")
+}
+
+// supportsAllSites reports whether an option accepts --all
+func supportsAllSites(option Option) bool {
+	if option.flags == nil {
+		return false
+	}
+	fs := flag.NewFlagSet(option.command, flag.ContinueOnError)
+	option.flags(fs)
+	return fs.Lookup("all") != nil
+}
+
+// targetSites returns every site when --all is set, otherwise the chosen one.
+func targetSites() []string {
+	if allSites {
+		return GetDirectoriesInPath("/home/" + USER + "/sites")
+	}
+	return []string{chosenSite}
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseGlobalFlags handles flags given before the command, like
+// `boost --dry-run` to open the menu in dry run mode. It returns the rest.
+func parseGlobalFlags(args []string) []string {
+	fs := flag.NewFlagSet("boost", flag.ExitOnError)
+	globalFlags(fs)
+	fs.Usage = printUsage
+	fs.Parse(args)
+	return fs.Args()
+}
+
+func globalFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&assumeYes, "yes", assumeYes, "answer yes to confirmation prompts")
+	fs.BoolVar(&dryRun, "dry-run", dryRun, "print commands instead of running them")
+}
+
+// applyGlobalFlags sets up state that depends on global flags
+func applyGlobalFlags() {
+	if dryRun {
+		runner = DryRunner{Out: os.Stdout}
+	}
+}
+
+// runCommand runs a single option non-interactively, e.g. `boost start mysite`.
+func runCommand(args []string) error {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return nil
+	}
+
+	if name == "update" {
+		if err := CheckForUpdate(); err != nil {
+			return err
+		}
+		fmt.Println("Already on the latest version.")
+		return nil
+	}
+
+	var option *Option
+	for i := range options {
+		if options[i].command == name {
+			option = &options[i]
+			break
+		}
+	}
+	if option == nil {
+		printUsage()
+		return &UsageError{"unknown command: " + name}
+	}
+
+	fs := flag.NewFlagSet(option.command, flag.ExitOnError)
+	globalFlags(fs)
+	if option.flags != nil {
+		option.flags(fs)
+	}
+	fs.Usage = func() {
+		usage := "Usage: boost " + option.command + " [flags]"
+		if option.chooseSite && supportsAllSites(*option) {
+			usage = "Usage: boost " + option.command + " [flags] <site | --all>"
+		} else if option.chooseSite {
+			usage = "Usage: boost " + option.command + " [flags] <site>"
+		}
+		fmt.Fprintf(fs.Output(), "%s\n\n%s\n\n", usage, option.name)
+		fs.PrintDefaults()
+	}
+
+	positional := parseInterspersed(fs, args[1:])
+
+	if option.chooseSite && allSites {
+		if len(positional) > 0 {
+			fs.Usage()
+			return &UsageError{"--all can't be used with a site"}
+		}
+	} else if option.chooseSite {
+		if len(positional) != 1 {
+			fs.Usage()
+			return &UsageError{"expected one site"}
+		}
+		chosenSite = positional[0]
+		if !SiteExists(chosenSite) {
+			return &UsageError{"site not found: " + chosenSite}
+		}
+	} else if len(positional) > 0 {
+		fs.Usage()
+		return &UsageError{"unexpected arguments: " + strings.Join(positional, " ")}
+	}
+
+	applyGlobalFlags()
+	scripted = true
+	chosenOption = option.name
+	return option.action()
+}
+
+// parseInterspersed parses flags that appear before or after positional
+// arguments and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) (positional []string) {
+	for {
+		// flag.ExitOnError handles any parse errors
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printUsage() {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "Usage: boost [--dry-run] [command] [flags] [site]")
+	fmt.Fprintln(&sb, "\nRun without a command to open the menu.")
+	fmt.Fprintln(&sb, "Use --dry-run to print the commands an action would run without running them.")
+	fmt.Fprintln(&sb, "\nCommands:")
+	for _, option := range options {
+		fmt.Fprintf(&sb, "  %-20s %s\n", option.command, option.name)
+	}
+	fmt.Fprintf(&sb, "  %-20s %s\n", "update", "Update boost to the latest version")
+	fmt.Fprintln(&sb, "\nRun 'boost <command> -h' to see the flags for a command.")
+	fmt.Print(sb.String())
+}
+
+// prompt runs an interactive form or field. Subcommands skip it and use the
+// values already set from flags.
+func prompt(p interface{ Run() error }) error {
+	if scripted {
+		return nil
+	}
+	return formAborted(p.Run())
+}
+
+// confirm asks a yes/no question. Subcommands answer it with --yes.
+func confirm(title, description string, value *bool) {
+	if scripted {
+		*value = assumeYes
+		return
+	}
+	huh.NewConfirm().
+		Title(title).
+		Description(description).
+		Value(value).
+		Run()
+}
+
+// spin shows a spinner while action runs. Subcommands and dry runs print the
+// title instead so output isn't mixed with the spinner.
+func spin(title string, action func() error) error {
+	if scripted || dryRun {
+		// stderr keeps --json output clean
+		fmt.Fprintln(os.Stderr, title)
+		return action()
+	}
+	var err error
+	spinner.New().Title(title).Action(func() {
+		err = action()
+	}).Run()
+	return err
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var cloneSiteArgs = struct {
+	name       string
+	domain     string
+	selfSigned bool
+	protect    string
+	authUser   string
+}{selfSigned: true, protect: "basic-auth", authUser: "staging"}
+
+func cloneSiteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cloneSiteArgs.name, "name", "", "name of the clone (default <site>-staging)")
+	fs.StringVar(&cloneSiteArgs.domain, "domain", "", "domain(s) of the clone, separated with a space")
+	fs.BoolVar(&cloneSiteArgs.selfSigned, "self-signed", true, "use a self-signed certificate (false generates one)")
+	fs.StringVar(&cloneSiteArgs.protect, "protect", "basic-auth", "hide the clone with basic-auth, maintenance or none")
+	fs.StringVar(&cloneSiteArgs.authUser, "auth-user", "staging", "basic auth username")
+}
+
+func cloneSite() error {
+	sourceDir := sitePath(chosenSite)
+	sourceCompose, err := ReadComposeFile(sourceDir + "/docker-compose.yml")
+	if err != nil {
+		return stepFailed("Read docker-compose.yml", err)
+	}
+	oldDomain, _ := sourceCompose.Label("wordpress", "caddy")
+
+	sitename := cloneSiteArgs.name
+	if sitename == "" {
+		sitename = chosenSite + "-staging"
+	}
+	domain := cloneSiteArgs.domain
+	useSelfSigned := cloneSiteArgs.selfSigned
+	protect := cloneSiteArgs.protect
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewNote().
+				Title("Clone "+chosenSite).
+				Description("Current domain(s): "+lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(oldDomain)),
+
+			huh.NewInput().
+				Title("Enter name of the clone").
+				Validate(func(s string) error {
+					return ValidateSiteName(ReplaceSpacesWithDashes(s))
+				}).
+				Value(&sitename),
+
+			huh.NewInput().
+				Title("Enter domain(s) of the clone").
+				Description("Separate domains with a space.").
+				Validate(ValidateDomains).
+				Value(&domain),
+
+			huh.NewConfirm().
+				Title("SSL Certificate").
+				Description("DNS must point to this server to generate.").
+				Affirmative("Self-Signed").
+				Negative("Generate SSL").
+				Value(&useSelfSigned),
+
+			huh.NewSelect[string]().
+				Title("Hide the clone from visitors").
+				Options(
+					huh.NewOption("Basic auth login", "basic-auth"),
+					huh.NewOption("Maintenance mode", "maintenance"),
+					huh.NewOption("Leave it public", "none"),
+				).
+				Value(&protect),
+		),
+	)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if sitename == "" || domain == "" {
+		return missing("name", "domain")
+	}
+	if err := ValidateDomains(domain); err != nil {
+		return &UsageError{err.Error()}
+	}
+	switch protect {
+	case "basic-auth", "maintenance", "none":
+	default:
+		return &UsageError{fmt.Sprintf("unknown --protect value %q, use basic-auth, maintenance or none", protect)}
+	}
+
+	sitename = ReplaceSpacesWithDashes(sitename)
+	if err := ValidateSiteName(sitename); err != nil {
+		return &UsageError{err.Error()}
+	}
+	siteDir := sitePath(sitename)
+	composeFile := siteDir + "/docker-compose.yml"
+
+	// wp-config.php doesn't exist until WordPress is installed, and until
+	// then the database has nothing to copy
+	sourceDb, err := SiteDatabase(chosenSite)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return stepFailed("Find database for "+chosenSite, err)
+	}
+
+	var db_name, db_user, db_pass string
+	if sourceDb != "" {
+		db_name = ReplaceDashWithUnderscore(sitename)
+		db_user = "u_" + ReplaceDashWithUnderscore(sitename)
+		db_pass, err = GeneratePassword(14)
+		if err != nil {
+			return stepFailed("Generate password", err)
+		}
+	}
+
+	var authUser, authPass string
+	if protect == "basic-auth" {
+		authUser = cloneSiteArgs.authUser
+		authPass, err = GeneratePassword(14)
+		if err != nil {
+			return stepFailed("Generate password", err)
+		}
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	var undo undoStack
+
+	err = spin(fmt.Sprintf("Cloning %s to %s...", chosenSite, sitename), func() error {
+		// copy site folder, keeping owners and permissions
+		if SiteExists(sitename) {
+			return stepFailed("Copy site folder", fmt.Errorf("%s already exists", siteDir))
+		}
+		undo.push("Removed "+siteDir, func() error {
+			_, err := sudoCommand("rm", "-rf", siteDir).Step("Remove directory")
+			return err
+		})
+		_, err := sudoCommand("cp", "-a", sourceDir, siteDir).Step("Copy site folder")
+		if err != nil {
+			return err
+		}
+
+		// point the compose file at the clone
+		err = do("rename "+chosenSite+" to "+sitename+" in "+composeFile, func() error {
+			compose, err := ReadComposeFile(composeFile)
+			if err != nil {
+				return err
+			}
+			compose.RenameSite(chosenSite, sitename)
+			if protect == "basic-auth" {
+				if err := compose.SetBasicAuth("wordpress", authUser, authPass); err != nil {
+					return err
+				}
+			}
+			return compose.Write()
+		})
+		if err != nil {
+			return stepFailed("Update docker-compose.yml", err)
+		}
+		err = do("set caddy label to "+domain+" in "+composeFile, func() error {
+			return setCaddyLabels(composeFile, domain, &useSelfSigned)
+		})
+		if err != nil {
+			return stepFailed("Set domain", err)
+		}
+
+		// copy database
+		if sourceDb != "" {
+			if err := createDatabase(&undo, db_name, db_user, db_pass); err != nil {
+				return err
+			}
+			staging, err := os.MkdirTemp("", "boost-clone-")
+			if err != nil {
+				return stepFailed("Create temporary folder", err)
+			}
+			defer os.RemoveAll(staging)
+			if err := DumpDatabase(sourceDb, staging+"/database.sql.gz"); err != nil {
+				return stepFailed("Dump database "+sourceDb, err)
+			}
+			if err := ImportDatabase(db_name, staging+"/database.sql.gz"); err != nil {
+				return stepFailed("Import database", err)
+			}
+			err = UpdateDefineValues(siteDir+"/wordpress/wp-config.php", map[string]string{
+				"DB_NAME":     db_name,
+				"DB_USER":     db_user,
+				"DB_PASSWORD": db_pass,
+			})
+			if err != nil {
+				return stepFailed("Update wp-config.php", err)
+			}
+		}
+
+		// start clone
+		undo.push("Removed containers", func() error {
+			_, err := command("docker", "compose", "-f", composeFile, "down").Step("Remove containers")
+			return err
+		})
+		_, err = command("docker", "compose", "-f", composeFile, "up", "-d").Step("Start containers")
+		if err != nil {
+			return err
+		}
+
+		// swap urls in the copied database
+		oldUrl, newUrl := firstDomain(oldDomain), firstDomain(domain)
+		if sourceDb != "" && oldUrl != "" && oldUrl != newUrl {
+			_, err = wpSearchReplace(sitename, oldUrl, newUrl).Step("Search and replace domain")
+			if err != nil {
+				return err
+			}
+		}
+
+		if protect == "maintenance" {
+			_, err = command("docker", "exec", sitename, "sh", "-c", "cd /usr/src/wordpress && wp maintenance-mode activate").Step("Enable maintenance mode")
+		}
+		return err
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
+
+	keyword := func(s string) string {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(s)
+	}
+	var sb strings.Builder
+	var clip strings.Builder
+	fmt.Fprint(&sb, lipgloss.NewStyle().Bold(true).Render(fmt.Sprintf("Cloned %s to %s!", chosenSite, sitename)))
+	if sourceDb != "" {
+		fmt.Fprintf(&sb, "\n\nDatabase: %s\nUsername: %s\nPassword: %s", keyword(db_name), keyword(db_user), keyword(db_pass))
+		fmt.Fprintf(&clip, "Database: %s\nUsername: %s\nPassword: %s\n", db_name, db_user, db_pass)
+	}
+	switch protect {
+	case "basic-auth":
+		fmt.Fprintf(&sb, "\n\nLogin:    %s\nPassword: %s", keyword(authUser), keyword(authPass))
+		fmt.Fprintf(&clip, "Login:    %s\nPassword: %s\n", authUser, authPass)
+	case "maintenance":
+		fmt.Fprint(&sb, "\n\nMaintenance mode is on.")
+	}
+	if clip.Len() > 0 {
+		clipboard.WriteAll(strings.TrimSpace(clip.String()))
+	}
+
+	printInBox(sb.String())
+	return nil
+}
+
+// firstDomain returns the first of a space separated list of domains
+// without a port.
+func firstDomain(domains string) string {
+	fields := strings.Fields(domains)
+	if len(fields) == 0 {
+		return ""
+	}
+	host, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "*."), ":")
+	return host
+}
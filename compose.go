@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeFile is a docker-compose.yml that can be edited in place without
+// losing comments, key order or blank lines between keys.
+type ComposeFile struct {
+	path string
+	doc  yaml.Node
+	// original lines, to find the blank lines the yaml encoder drops
+	lines []string
+}
+
+// ReadComposeFile parses the compose file at path.
+func ReadComposeFile(path string) (*ComposeFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseComposeFile(path, content)
+}
+
+// ParseComposeFile parses compose file content. path is only used when writing.
+func ParseComposeFile(path string, content []byte) (*ComposeFile, error) {
+	c := &ComposeFile{path: path, lines: strings.Split(string(content), "\n")}
+	if err := yaml.Unmarshal(content, &c.doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if c.doc.Kind != yaml.DocumentNode || len(c.doc.Content) == 0 || c.doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse %s: not a compose file", path)
+	}
+	return c, nil
+}
+
+// mapValue returns the value node for key in a mapping node
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func (c *ComposeFile) service(name string) (*yaml.Node, error) {
+	service := mapValue(mapValue(c.doc.Content[0], "services"), name)
+	if service == nil || service.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: service %q not found", c.path, name)
+	}
+	return service, nil
+}
+
+// labels returns the labels node of a service, creating it if asked
+func (c *ComposeFile) labels(name string, create bool) (*yaml.Node, error) {
+	service, err := c.service(name)
+	if err != nil {
+		return nil, err
+	}
+	labels := mapValue(service, "labels")
+	if labels == nil && create {
+		labels = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		service.Content = append(service.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "labels"},
+			labels,
+		)
+	}
+	return labels, nil
+}
+
+// Labels returns the labels of a service. Both the map and the list
+// ("key=value") forms are supported.
+func (c *ComposeFile) Labels(service string) (map[string]string, error) {
+	node, err := c.labels(service, false)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	if node == nil {
+		return labels, nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			labels[node.Content[i].Value] = node.Content[i+1].Value
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			labels[key] = value
+		}
+	}
+	return labels, nil
+}
+
+// Label returns a single label of a service.
+func (c *ComposeFile) Label(service, key string) (string, bool) {
+	labels, err := c.Labels(service)
+	if err != nil {
+		return "", false
+	}
+	value, ok := labels[key]
+	return value, ok
+}
+
+// SetLabel adds or replaces a label of a service.
+func (c *ComposeFile) SetLabel(service, key, value string) error {
+	node, err := c.labels(service, true)
+	if err != nil {
+		return err
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		if existing := mapValue(node, key); existing != nil {
+			// drop any tag or quoting style so the new value is encoded safely
+			*existing = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, LineComment: existing.LineComment}
+			return nil
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+		)
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if k, _, _ := strings.Cut(item.Value, "="); k == key {
+				*item = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key + "=" + value, LineComment: item.LineComment}
+				return nil
+			}
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key + "=" + value})
+	default:
+		return fmt.Errorf("%s: labels of %q are not a map or list", c.path, service)
+	}
+	return nil
+}
+
+// DeleteLabel removes a label from a service if it exists.
+func (c *ComposeFile) DeleteLabel(service, key string) error {
+	node, err := c.labels(service, false)
+	if err != nil || node == nil {
+		return err
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				return nil
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if k, _, _ := strings.Cut(item.Value, "="); k == key {
+				node.Content = append(node.Content[:i], node.Content[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Services returns the service names, sorted.
+func (c *ComposeFile) Services() []string {
+	services := mapValue(c.doc.Content[0], "services")
+	if services == nil {
+		return nil
+	}
+	var names []string
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		names = append(names, services.Content[i].Value)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Image returns the image of a service.
+func (c *ComposeFile) Image(service string) string {
+	node, err := c.service(service)
+	if err != nil {
+		return ""
+	}
+	if image := mapValue(node, "image"); image != nil {
+		return image.Value
+	}
+	return ""
+}
+
+// RenameSite points a copy of a site's compose file at its new name. The
+// container names and volume paths that were made from CHANGE_TO_SITE_NAME
+// are rewritten, anything else is left alone.
+func (c *ComposeFile) RenameSite(oldSite, newSite string) {
+	oldDir, newDir := sitePath(oldSite), sitePath(newSite)
+	renamePath := func(node *yaml.Node) {
+		if node.Value == oldDir || strings.HasPrefix(node.Value, oldDir+"/") || strings.HasPrefix(node.Value, oldDir+":") {
+			*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: newDir + strings.TrimPrefix(node.Value, oldDir), LineComment: node.LineComment}
+		}
+	}
+
+	services := mapValue(c.doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 1; i < len(services.Content); i += 2 {
+		service := services.Content[i]
+		if name := mapValue(service, "container_name"); name != nil {
+			if name.Value == oldSite || strings.HasPrefix(name.Value, oldSite+"-") {
+				name.Value = newSite + strings.TrimPrefix(name.Value, oldSite)
+			}
+		}
+		volumes := mapValue(service, "volumes")
+		if volumes == nil || volumes.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, volume := range volumes.Content {
+			switch volume.Kind {
+			case yaml.ScalarNode:
+				renamePath(volume)
+			case yaml.MappingNode:
+				if source := mapValue(volume, "source"); source != nil {
+					renamePath(source)
+				}
+			}
+		}
+	}
+}
+
+// SetBasicAuth puts a site's wordpress service behind a Caddy basic auth
+// login.
+func (c *ComposeFile) SetBasicAuth(service, user, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := c.SetLabel(service, "caddy.basicauth", "/*"); err != nil {
+		return err
+	}
+	// compose interpolates $ in labels, so the hash needs escaping
+	return c.SetLabel(service, "caddy.basicauth."+user, strings.ReplaceAll(string(hash), "$", "$$"))
+}
+
+// Bytes encodes the compose file.
+func (c *ComposeFile) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&c.doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return c.restoreBlankLines(buf.Bytes())
+}
+
+// keyLines maps the path of every mapping key under node to the node of
+// the key.
+func keyLines(node *yaml.Node, path string, keys map[string]*yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			keyLines(child, path, keys)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyPath := path + "/" + node.Content[i].Value
+			keys[keyPath] = node.Content[i]
+			keyLines(node.Content[i+1], keyPath, keys)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			keyLines(child, fmt.Sprintf("%s/%d", path, i), keys)
+		}
+	}
+}
+
+// aboveComments returns the index of the line above a key and its head
+// comment, or -1 at the top of the file. line is 1-based like yaml.Node.
+func aboveComments(lines []string, line int) int {
+	i := line - 2
+	for i >= 0 && strings.HasPrefix(strings.TrimSpace(lines[i]), "#") {
+		i--
+	}
+	return i
+}
+
+// restoreBlankLines puts back the blank lines that separated keys in the
+// original file, like the ones between services. Blank lines between
+// comments aren't kept.
+func (c *ComposeFile) restoreBlankLines(encoded []byte) ([]byte, error) {
+	original := make(map[string]*yaml.Node)
+	keyLines(&c.doc, "", original)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+	encodedKeys := make(map[string]*yaml.Node)
+	keyLines(&doc, "", encodedKeys)
+
+	lines := strings.Split(string(encoded), "\n")
+	blank := make(map[int]bool)
+	for path, key := range original {
+		// keys added since the file was read have no line
+		if key.Line == 0 || key.Line > len(c.lines) {
+			continue
+		}
+		if i := aboveComments(c.lines, key.Line); i < 0 || strings.TrimSpace(c.lines[i]) != "" {
+			continue
+		}
+		if encodedKey := encodedKeys[path]; encodedKey != nil {
+			if i := aboveComments(lines, encodedKey.Line); i >= 0 {
+				blank[i+1] = true
+			}
+		}
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		if blank[i] {
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+		if i < len(lines)-1 {
+			out.WriteString("\n")
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// Validate checks that the encoded file parses as a compose file and that
+// every service's labels are plain strings.
+func (c *ComposeFile) Validate() error {
+	content, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+	var compose struct {
+		Services map[string]struct {
+			Image  string `yaml:"image"`
+			Labels any    `yaml:"labels"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return fmt.Errorf("%s: invalid yaml: %w", c.path, err)
+	}
+	if len(compose.Services) == 0 {
+		return fmt.Errorf("%s: no services defined", c.path)
+	}
+	for name, service := range compose.Services {
+		switch labels := service.Labels.(type) {
+		case nil:
+		case map[string]any:
+			for key, value := range labels {
+				if _, ok := value.(string); !ok {
+					return fmt.Errorf("%s: label %q of %q is not a string", c.path, key, name)
+				}
+			}
+		case []any:
+			for _, value := range labels {
+				if s, ok := value.(string); !ok || !strings.Contains(s, "=") {
+					return fmt.Errorf("%s: label %v of %q is not key=value", c.path, value, name)
+				}
+			}
+		default:
+			return fmt.Errorf("%s: labels of %q are not a map or list", c.path, name)
+		}
+	}
+	return nil
+}
+
+// Write validates the compose file and replaces the file on disk.
+func (c *ComposeFile) Write() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	content, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+	return do("write "+c.path, func() error {
+		return WriteFileAtomic(c.path, content)
+	})
+}
+
+// WriteFileAtomic writes content to a temporary file next to path and
+// renames it into place, keeping the permissions of any existing file.
+func WriteFileAtomic(path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	if _, err := out.Write(content); err != nil {
+		return err
+	}
+	if err := out.Chmod(mode); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+var domainPattern = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(:[0-9]{1,5})?$`)
+
+// ValidateDomains checks a space separated list of domains for the caddy label.
+func ValidateDomains(s string) error {
+	domains := strings.Fields(s)
+	if len(domains) == 0 {
+		return errors.New("domain cannot be empty")
+	}
+	for _, domain := range domains {
+		if !domainPattern.MatchString(domain) {
+			return fmt.Errorf("invalid domain: %q", domain)
+		}
+	}
+	return nil
+}
+
+// setCaddyLabels updates the caddy labels of a site's wordpress service.
+// Self-signed sites use Caddy's internal certificates, others get one
+// through ACME.
+func setCaddyLabels(composeFile, domain string, selfSigned *bool) error {
+	if err := ValidateDomains(domain); err != nil {
+		return err
+	}
+	compose, err := ReadComposeFile(composeFile)
+	if err != nil {
+		return err
+	}
+	if err := compose.SetLabel("wordpress", "caddy", strings.Join(strings.Fields(domain), " ")); err != nil {
+		return err
+	}
+	if selfSigned != nil {
+		if *selfSigned {
+			err = compose.SetLabel("wordpress", "caddy.tls", "internal")
+		} else {
+			err = compose.DeleteLabel("wordpress", "caddy.tls")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return compose.Write()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestComposeFileKeepsLayout(t *testing.T) {
+	template, err := os.ReadFile("templates/wordpress/docker-compose.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"template", string(template)},
+		{"blank lines before comments", "services:\n  a:\n    image: x\n\n  # about b\n  b:\n    image: y\n\n\n# shared\nnetworks:\n  n:\n    external: true\n"},
+		{"no blank lines", "services:\n  a:\n    image: x\n    labels:\n      caddy: example.com\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compose, err := ParseComposeFile("docker-compose.yml", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := compose.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// runs of blank lines become one
+			want := strings.ReplaceAll(tt.content, "\n\n\n", "\n\n")
+			if string(encoded) != want {
+				t.Errorf("unchanged file was rewritten:\n%s", encoded)
+			}
+		})
+	}
+}
+
+func TestComposeFileSetLabel(t *testing.T) {
+	content, err := os.ReadFile("templates/wordpress/docker-compose.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compose, err := ParseComposeFile("docker-compose.yml", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compose.SetLabel("wordpress", "caddy", "a.com www.a.com"); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := compose.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(string(content), "caddy: example.com", "caddy: a.com www.a.com", 1)
+	if string(encoded) != want {
+		t.Errorf("SetLabel changed more than the label:\n%s", encoded)
+	}
+}
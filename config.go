@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds settings read from ~/.config/boost/config.yml. Every setting
+// has a default so the file is optional.
+type Config struct {
+	// where backups are stored, one folder per site
+	BackupsDir string `yaml:"backups_dir"`
+	// compression for site archives, gz or zst
+	BackupFormat string `yaml:"backup_format"`
+	// how many backups prune-backups keeps for each site
+	Retention RetentionPolicy `yaml:"retention"`
+}
+
+// RetentionPolicy keeps the newest backup of each of the last Daily days,
+// Weekly weeks and Monthly months. A backup can count for more than one.
+type RetentionPolicy struct {
+	Daily   int `yaml:"daily"`
+	Weekly  int `yaml:"weekly"`
+	Monthly int `yaml:"monthly"`
+}
+
+func configPath() string {
+	return "/home/" + USER + "/.config/boost/config.yml"
+}
+
+func defaultConfig() Config {
+	return Config{
+		BackupsDir:   "/home/" + USER + "/backups",
+		BackupFormat: "gz",
+		Retention:    RetentionPolicy{Daily: 7, Weekly: 4, Monthly: 6},
+	}
+}
+
+// LoadConfig reads the config file on top of the defaults.
+func LoadConfig() (Config, error) {
+	config := defaultConfig()
+	content, err := os.ReadFile(configPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", configPath(), err)
+	}
+	return config, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dockerStatsLine is a line of docker stats --format json. All values are
+// text, like "40.2MiB / 7.6GiB".
+type dockerStatsLine struct {
+	Name     string
+	CPUPerc  string
+	MemUsage string
+	MemPerc  string
+	NetIO    string
+	BlockIO  string
+}
+
+// ContainerStats is the resource usage of a running container.
+type ContainerStats struct {
+	Name    string
+	Project string
+	// CPU is a percentage of one core, like docker stats shows it
+	CPU        float64
+	MemUsed    int64
+	MemLimit   int64
+	MemPercent float64
+	NetIn      int64
+	NetOut     int64
+	BlockRead  int64
+	BlockWrite int64
+}
+
+var dockerSizeRe = regexp.MustCompile(`^([\d.]+)\s*([a-zA-Z]*)$`)
+
+// docker shows memory in binary units and I/O in decimal ones
+var dockerSizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// ParseDockerSize reads a size like 40.2MiB or 1.2kB.
+func ParseDockerSize(s string) (int64, error) {
+	match := dockerSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := dockerSizeUnits[match[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(math.Round(value * unit)), nil
+}
+
+// parseDockerSizes reads a pair of sizes like "1.2kB / 0B".
+func parseDockerSizes(s string) (int64, int64, error) {
+	// docker shows -- for containers that are starting or stopping
+	if strings.TrimSpace(s) == "--" {
+		return 0, 0, nil
+	}
+	first, second, found := strings.Cut(s, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid sizes %q", s)
+	}
+	a, err := ParseDockerSize(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := ParseDockerSize(second)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	// docker shows -- for containers that are starting or stopping
+	if s == "" || s == "--" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseDockerStats reads the output of docker stats --format json, one
+// object per line.
+func ParseDockerStats(output string) ([]ContainerStats, error) {
+	var stats []ContainerStats
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var raw dockerStatsLine
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return nil, fmt.Errorf("unexpected docker stats line %q: %w", line, err)
+		}
+		s := ContainerStats{Name: raw.Name}
+		var err error
+		if s.CPU, err = parsePercent(raw.CPUPerc); err != nil {
+			return nil, fmt.Errorf("%s: cpu: %w", raw.Name, err)
+		}
+		if s.MemPercent, err = parsePercent(raw.MemPerc); err != nil {
+			return nil, fmt.Errorf("%s: memory: %w", raw.Name, err)
+		}
+		if s.MemUsed, s.MemLimit, err = parseDockerSizes(raw.MemUsage); err != nil {
+			return nil, fmt.Errorf("%s: memory: %w", raw.Name, err)
+		}
+		if s.NetIn, s.NetOut, err = parseDockerSizes(raw.NetIO); err != nil {
+			return nil, fmt.Errorf("%s: network: %w", raw.Name, err)
+		}
+		if s.BlockRead, s.BlockWrite, err = parseDockerSizes(raw.BlockIO); err != nil {
+			return nil, fmt.Errorf("%s: block I/O: %w", raw.Name, err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// GetContainerStats returns the usage of running containers with their
+// compose project.
+func GetContainerStats() ([]ContainerStats, error) {
+	output, err := command("docker", "stats", "--no-stream", "--format", "json").ReadOnly().OutputStep("Read container stats")
+	if err != nil {
+		return nil, err
+	}
+	stats, err := ParseDockerStats(string(output))
+	if err != nil {
+		return nil, stepFailed("Read container stats", err)
+	}
+	containers, err := ListComposeContainers()
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string]string)
+	for _, container := range containers {
+		projects[container.Name] = container.Project
+	}
+	for i := range stats {
+		stats[i].Project = projects[stats[i].Name]
+	}
+	return stats, nil
+}
+
+// ProjectStats is the usage of the containers of a compose project.
+type ProjectStats struct {
+	Project    string
+	CPU        float64
+	MemUsed    int64
+	Containers []ContainerStats
+}
+
+// GroupContainerStats groups containers by compose project. Projects and
+// the containers in them are sorted by CPU, then memory, busiest first.
+func GroupContainerStats(stats []ContainerStats) []ProjectStats {
+	byProject := make(map[string]*ProjectStats)
+	var groups []*ProjectStats
+	for _, s := range stats {
+		group := byProject[s.Project]
+		if group == nil {
+			group = &ProjectStats{Project: s.Project}
+			byProject[s.Project] = group
+			groups = append(groups, group)
+		}
+		group.CPU += s.CPU
+		group.MemUsed += s.MemUsed
+		group.Containers = append(group.Containers, s)
+	}
+
+	busier := func(cpuA, cpuB float64, memA, memB int64) bool {
+		if cpuA != cpuB {
+			return cpuA > cpuB
+		}
+		return memA > memB
+	}
+	sorted := make([]ProjectStats, 0, len(groups))
+	for _, group := range groups {
+		sort.SliceStable(group.Containers, func(i, j int) bool {
+			a, b := group.Containers[i], group.Containers[j]
+			return busier(a.CPU, b.CPU, a.MemUsed, b.MemUsed)
+		})
+		sorted = append(sorted, *group)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return busier(sorted[i].CPU, sorted[j].CPU, sorted[i].MemUsed, sorted[j].MemUsed)
+	})
+	return sorted
+}
+
+// renderContainerStats renders a table of container usage. CPU is shown
+// as a share of all cores, and both CPU and memory are colored with the
+// thresholds of the host's memory.
+func renderContainerStats(groups []ProjectStats, cores int) string {
+	var rows [][]string
+	for _, group := range groups {
+		for i, s := range group.Containers {
+			project := ""
+			if i == 0 {
+				project = orDash(group.Project)
+			}
+			rows = append(rows, []string{
+				project,
+				s.Name,
+				renderStatusPercentage(s.CPU/float64(max(cores, 1)), [2]float64{60, 80}),
+				FormatBytes(s.MemUsed) + " / " + FormatBytes(s.MemLimit),
+				renderStatusPercentage(s.MemPercent, [2]float64{60, 80}),
+				FormatBytes(s.NetIn) + " / " + FormatBytes(s.NetOut),
+				FormatBytes(s.BlockRead) + " / " + FormatBytes(s.BlockWrite),
+			})
+		}
+	}
+	return renderTable([]string{"Project", "Container", "CPU (host)", "Memory", "Mem %", "Net in / out", "Block read / write"}, rows)
+}
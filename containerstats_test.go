@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDockerSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{"0B", 0, false},
+		{"512B", 512, false},
+		{"1.2kB", 1200, false},
+		{"3.46MB", 3460000, false},
+		{"40.2MiB", 42152755, false},
+		{"7.6GiB", 8160437862, false},
+		{" 1.5GB ", 1500000000, false},
+		{"42", 42, false},
+		{"1.2 kB", 1200, false},
+		{"--", 0, true},
+		{"1.2XB", 0, true},
+		{"1.2.3MB", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDockerSize(tt.size)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDockerSize(%q) = %d, %v, want %d, error %v", tt.size, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDockerStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []ContainerStats
+		wantErr bool
+	}{
+		{
+			name: "docker stats --no-stream --format json",
+			output: `{"BlockIO":"25.4MB / 184MB","CPUPerc":"0.02%","Container":"8f1c2a3b4d5e","ID":"8f1c2a3b4d5e","MemPerc":"2.61%","MemUsage":"204.3MiB / 7.6GiB","Name":"shop","NetIO":"1.2GB / 3.46GB","PIDs":"11"}
+{"BlockIO":"0B / 0B","CPUPerc":"125.40%","Container":"a1b2c3d4e5f6","ID":"a1b2c3d4e5f6","MemPerc":"0.05%","MemUsage":"3.9MiB / 7.6GiB","Name":"shop-redis","NetIO":"1.2kB / 0B","PIDs":"5"}
+`,
+			want: []ContainerStats{
+				{
+					Name: "shop", CPU: 0.02, MemUsed: 214224077, MemLimit: 8160437862, MemPercent: 2.61,
+					NetIn: 1200000000, NetOut: 3460000000, BlockRead: 25400000, BlockWrite: 184000000,
+				},
+				{
+					Name: "shop-redis", CPU: 125.4, MemUsed: 4089446, MemLimit: 8160437862, MemPercent: 0.05,
+					NetIn: 1200,
+				},
+			},
+		},
+		{
+			name:   "container still starting",
+			output: `{"BlockIO":"--","CPUPerc":"--","MemPerc":"--","MemUsage":"0B / 0B","Name":"shop","NetIO":"--"}` + "\n",
+			want:   []ContainerStats{{Name: "shop"}},
+		},
+		{name: "no containers", output: "", want: nil},
+		{name: "not json", output: "CONTAINER ID   NAME   CPU %\n", wantErr: true},
+		{
+			name:    "bad memory",
+			output:  `{"BlockIO":"0B / 0B","CPUPerc":"0.00%","MemPerc":"0.00%","MemUsage":"lots","Name":"shop","NetIO":"0B / 0B"}` + "\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDockerStats(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// database and user names go into queries unquoted
+var sqlNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// mariadbQuery runs a query as root in the mariadb container. Values are
+// passed as environment variables so the query can use $DB_NAME and friends
+// without quoting them into the command line.
+func mariadbQuery(query string, env ...string) *Cmd {
+	args := []string{"exec"}
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	args = append(args, "mariadb", "bash", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -e \""+query+"\"")
+	return command("docker", args...)
+}
+
+// mariadbSelect runs a read-only query against dbName and returns the rows
+// as tab separated fields. The query is passed through the environment so it
+// can quote identifiers with backticks.
+func mariadbSelect(step, dbName, query string) ([][]string, error) {
+	output, err := command("docker", "exec", "-e", "DB_NAME="+dbName, "-e", "QUERY="+query, "mariadb", "sh", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" -N -B -e \"$QUERY\" \"$DB_NAME\"").ReadOnly().OutputStep(step)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
+
+// TableRowCounts returns the exact number of rows in every table of dbName.
+func TableRowCounts(dbName string) (map[string]int64, error) {
+	tables, err := mariadbSelect("List tables in "+dbName, dbName, "SHOW TABLES")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	if len(tables) == 0 {
+		return counts, nil
+	}
+	parts := make([]string, 0, len(tables))
+	for _, table := range tables {
+		literal := strings.NewReplacer(`\`, `\\`, "'", "''").Replace(table[0])
+		parts = append(parts, fmt.Sprintf("SELECT '%s', COUNT(*) FROM `%s`", literal, strings.ReplaceAll(table[0], "`", "``")))
+	}
+	rows, err := mariadbSelect("Count rows in "+dbName, dbName, strings.Join(parts, " UNION ALL "))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) != 2 {
+			continue
+		}
+		count, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, stepFailed("Count rows in "+dbName, err)
+		}
+		counts[row[0]] = count
+	}
+	return counts, nil
+}
+
+// createDatabase creates a database and a user with access to it, pushing
+// an undo for each step.
+func createDatabase(undo *undoStack, dbName, dbUser, dbPass string) error {
+	_, err := mariadbQuery("CREATE DATABASE $DB_NAME;", "DB_NAME="+dbName).Step("Create database")
+	if err != nil {
+		return err
+	}
+	undo.push("Dropped database "+dbName, func() error {
+		_, err := mariadbQuery("DROP DATABASE IF EXISTS $DB_NAME;", "DB_NAME="+dbName).Step("Drop database")
+		return err
+	})
+	// create user
+	_, err = mariadbQuery("CREATE USER '$DB_USER'@'%' IDENTIFIED BY '$DB_PASSWORD';", "DB_USER="+dbUser, "DB_PASSWORD="+dbPass).WithSecrets(dbPass).Step("Create database user")
+	if err != nil {
+		return err
+	}
+	undo.push("Dropped user "+dbUser, func() error {
+		_, err := mariadbQuery("DROP USER IF EXISTS '$DB_USER'@'%';", "DB_USER="+dbUser).Step("Drop database user")
+		return err
+	})
+	// grant user privileges to database
+	_, err = mariadbQuery("GRANT ALL PRIVILEGES ON $DB_NAME.* TO '$DB_USER'@'%';", "DB_NAME="+dbName, "DB_USER="+dbUser).Step("Grant database privileges")
+	if err != nil {
+		return err
+	}
+	undo.push("Revoked privileges for "+dbUser, func() error {
+		_, err := mariadbQuery("REVOKE ALL PRIVILEGES ON $DB_NAME.* FROM '$DB_USER'@'%';", "DB_NAME="+dbName, "DB_USER="+dbUser).Step("Revoke database privileges")
+		return err
+	})
+	return nil
+}
+
+// ImportDatabase loads a gzip compressed dump into dbName.
+func ImportDatabase(dbName, dumpFile string) error {
+	cmd := command("docker", "exec", "-i", "-e", "DB_NAME="+dbName, "mariadb", "sh", "-c", "mysql -uroot -p\"$MYSQL_ROOT_PASSWORD\" \"$DB_NAME\"")
+	return do("gunzip -c "+dumpFile+" | "+cmd.String(), func() error {
+		file, err := os.Open(dumpFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = gz
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return cmd.stepError("Import database "+dbName, output, err)
+		}
+		return nil
+	})
+}
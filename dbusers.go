@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// accounts that come with MariaDB and are never shown or dropped
+var systemDatabaseUsers = map[string]bool{
+	"root":        true,
+	"mariadb.sys": true,
+	"mysql":       true,
+	"healthcheck": true,
+	"":            true,
+}
+
+// DatabaseUser is a MariaDB account with the site that uses it, if any.
+type DatabaseUser struct {
+	User   string   `json:"user"`
+	Host   string   `json:"host"`
+	Site   string   `json:"site"`
+	Grants []string `json:"grants"`
+}
+
+// Orphaned reports whether a user was made for a site that is gone.
+func (u DatabaseUser) Orphaned() bool {
+	return u.Site == "" && strings.HasPrefix(u.User, "u_")
+}
+
+// sqlString quotes a value for use in a query
+func sqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s) + "'"
+}
+
+// siteDatabaseUsers maps database users to the sites that use them: the
+// user createSite made for the site, and the one in its wp-config.php.
+func siteDatabaseUsers() map[string]string {
+	users := make(map[string]string)
+	for _, site := range GetDirectoriesInPath("/home/" + USER + "/sites") {
+		// wp-config.php doesn't exist until WordPress is installed
+		users["u_"+ReplaceDashWithUnderscore(site)] = site
+		values, err := ReadDefineValues(sitePath(site) + "/wordpress/wp-config.php")
+		if err != nil {
+			continue
+		}
+		if user := values["DB_USER"]; user != "" {
+			users[user] = site
+		}
+	}
+	return users
+}
+
+// ListDatabaseUsers returns the MariaDB accounts other than the built in
+// ones, with their grants.
+func ListDatabaseUsers() ([]DatabaseUser, error) {
+	rows, err := mariadbSelect("List database users", "mysql", "SELECT User, Host FROM mysql.user ORDER BY User, Host")
+	if err != nil {
+		return nil, err
+	}
+	sites := siteDatabaseUsers()
+	var users []DatabaseUser
+	for _, row := range rows {
+		if len(row) != 2 || systemDatabaseUsers[row[0]] {
+			continue
+		}
+		user := DatabaseUser{User: row[0], Host: row[1], Site: sites[row[0]], Grants: []string{}}
+		grants, err := mariadbSelect("Show grants for "+user.User, "mysql", "SHOW GRANTS FOR "+sqlString(user.User)+"@"+sqlString(user.Host))
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			user.Grants = append(user.Grants, grant[0])
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+var listDatabaseUsersArgs struct {
+	json bool
+}
+
+func listDatabaseUsersFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&listDatabaseUsersArgs.json, "json", false, "print as JSON")
+}
+
+func listDatabaseUsers() error {
+	var users []DatabaseUser
+	err := spin("Reading database users...", func() error {
+		var err error
+		users, err = ListDatabaseUsers()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if listDatabaseUsersArgs.json {
+		return printJSON(users)
+	}
+	if len(users) == 0 {
+		printInBox("No database users besides root.")
+		return nil
+	}
+
+	orphaned := lipgloss.NewStyle().Foreground(lipgloss.Color("160")).Render("orphaned")
+	rows := make([][]string, 0, len(users))
+	for _, user := range users {
+		site := orDash(user.Site)
+		if user.Orphaned() {
+			site = orphaned
+		}
+		// the password hash in grants isn't useful here
+		grants := make([]string, 0, len(user.Grants))
+		for _, grant := range user.Grants {
+			grant, _, _ = strings.Cut(grant, " IDENTIFIED BY")
+			grants = append(grants, grant)
+		}
+		rows = append(rows, []string{user.User + "@" + user.Host, site, strings.Join(grants, "\n")})
+	}
+	fmt.Println(renderTable([]string{"User", "Site", "Grants"}, rows))
+	return nil
+}
+
+func dropOrphanedDatabaseUsers() error {
+	var users []DatabaseUser
+	err := spin("Reading database users...", func() error {
+		var err error
+		users, err = ListDatabaseUsers()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var orphans []DatabaseUser
+	for _, user := range users {
+		if user.Orphaned() {
+			orphans = append(orphans, user)
+		}
+	}
+	if len(orphans) == 0 {
+		printInBox("No orphaned database users. Have a tidy day!")
+		return nil
+	}
+
+	names := make([]string, 0, len(orphans))
+	for _, user := range orphans {
+		names = append(names, user.User+"@"+user.Host)
+	}
+	confirmed := false
+	confirm(
+		fmt.Sprintf("Drop %d orphaned database users?", len(orphans)),
+		"No site uses these users:\n"+strings.Join(names, "\n"),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	err = spin("Dropping users...", func() error {
+		for _, user := range orphans {
+			_, err := mariadbQuery("DROP USER IF EXISTS '$DB_USER'@'$DB_USER_HOST';", "DB_USER="+user.User, "DB_USER_HOST="+user.Host).Step("Drop database user " + user.User)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	printInBox(fmt.Sprintf("Dropped %s. Have a pristine day!", strings.Join(names, ", ")))
+	return nil
+}
+
+var rotateDatabasePasswordArgs struct {
+	password string
+}
+
+func rotateDatabasePasswordFlags(fs *flag.FlagSet) {
+	fs.StringVar(&rotateDatabasePasswordArgs.password, "password", "", "new password (default random)")
+}
+
+func rotateDatabasePassword() error {
+	wpConfig := sitePath(chosenSite) + "/wordpress/wp-config.php"
+	if _, err := SiteDatabase(chosenSite); err != nil {
+		return stepFailed("Find database for "+chosenSite, err)
+	}
+	values, err := ReadDefineValues(wpConfig)
+	if err != nil {
+		return stepFailed("Read wp-config.php", err)
+	}
+	dbUser, oldPass := values["DB_USER"], values["DB_PASSWORD"]
+	if dbUser == "" {
+		return stepFailed("Read wp-config.php", fmt.Errorf("DB_USER not found in %s", wpConfig))
+	}
+
+	newPass := rotateDatabasePasswordArgs.password
+	if newPass == "" {
+		newPass, err = GeneratePassword(14)
+		if err != nil {
+			return stepFailed("Generate password", err)
+		}
+	}
+	// the password is written into wp-config.php between single quotes, and
+	// read back by a pattern that stops at either quote
+	if strings.ContainsAny(newPass, `'"\`) {
+		return &UsageError{"password can't contain single or double quotes or backslashes"}
+	}
+
+	confirmed := true
+	confirm(
+		fmt.Sprintf("Change the database password of %s?", chosenSite),
+		fmt.Sprintf("User %s gets a new password in MariaDB and wp-config.php, then the site restarts.", dbUser),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	var undo undoStack
+
+	err = spin("Changing password...", func() error {
+		_, err := mariadbQuery("ALTER USER '$DB_USER'@'%' IDENTIFIED BY '$DB_PASSWORD';", "DB_USER="+dbUser, "DB_PASSWORD="+newPass).WithSecrets(newPass).Step("Change database password")
+		if err != nil {
+			return err
+		}
+		undo.push("Restored old password of "+dbUser, func() error {
+			_, err := mariadbQuery("ALTER USER '$DB_USER'@'%' IDENTIFIED BY '$DB_PASSWORD';", "DB_USER="+dbUser, "DB_PASSWORD="+oldPass).WithSecrets(oldPass).Step("Restore database password")
+			return err
+		})
+
+		err = UpdateDefineValues(wpConfig, map[string]string{"DB_PASSWORD": newPass})
+		if err != nil {
+			return stepFailed("Update wp-config.php", err)
+		}
+		undo.push("Restored wp-config.php", func() error {
+			return UpdateDefineValues(wpConfig, map[string]string{"DB_PASSWORD": oldPass})
+		})
+
+		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" restart
+		_, err = command("docker", "compose", "-f", sitePath(chosenSite)+"/docker-compose.yml", "restart").Step("Restart containers")
+		return err
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
+
+	printInBox(fmt.Sprintf("New password for %s: %s\n\nHave a secure day!", dbUser, lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Render(newPass)))
+	return nil
+}
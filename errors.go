@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// errAborted means the user backed out of a prompt
+var errAborted = errors.New("aborted")
+
+// errUpdated means boost replaced itself with a newer version
+var errUpdated = errors.New("updated")
+
+// errDeclined means a confirmation was answered with no
+var errDeclined = errors.New("not confirmed, pass --yes to continue without prompting")
+
+// UsageError is returned when a subcommand is missing input.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// StepError describes a step of an action that failed.
+type StepError struct {
+	Step     string
+	Command  string
+	Output   string
+	ExitCode int
+	Err      error
+}
+
+func (e *StepError) Error() string {
+	if e.Output != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Step, e.Err, e.Output)
+	}
+	return fmt.Sprintf("%s: %s", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// stepFailed wraps err for a step that doesn't run a command
+func stepFailed(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StepError{Step: step, ExitCode: -1, Err: err}
+}
+
+func (c *Cmd) stepError(step string, output []byte, err error) *StepError {
+	e := &StepError{
+		Step:     step,
+		Command:  c.String(),
+		Output:   c.mask(strings.TrimSpace(string(output))),
+		ExitCode: -1,
+		Err:      err,
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+	return e
+}
+
+// Step runs the command and returns its combined output. Failures are
+// returned as a StepError.
+func (c *Cmd) Step(step string) ([]byte, error) {
+	output, err := c.CombinedOutput()
+	if err != nil {
+		return output, c.stepError(step, output, err)
+	}
+	return output, nil
+}
+
+// OutputStep is like Step but only returns stdout.
+func (c *Cmd) OutputStep(step string) ([]byte, error) {
+	output, err := c.Output()
+	if err != nil {
+		var stderr []byte
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = exitErr.Stderr
+		}
+		return output, c.stepError(step, stderr, err)
+	}
+	return output, nil
+}
+
+// RunStep runs a command attached to the terminal.
+func (c *Cmd) RunStep(step string) error {
+	if err := c.Run(); err != nil {
+		return c.stepError(step, nil, err)
+	}
+	return nil
+}
+
+// RollbackError reports what was undone after a failed action.
+type RollbackError struct {
+	Err    error
+	Undone []string
+	Failed []string
+}
+
+func (e *RollbackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+type undoStep struct {
+	description string
+	undo        func() error
+}
+
+// undoStack records how to reverse completed steps so a failed action can
+// clean up after itself.
+type undoStack []undoStep
+
+func (u *undoStack) push(description string, undo func() error) {
+	*u = append(*u, undoStep{description, undo})
+}
+
+// rollback undoes completed steps in reverse order and attaches a report to err.
+func (u *undoStack) rollback(err error) error {
+	if err == nil || len(*u) == 0 {
+		return err
+	}
+	report := &RollbackError{Err: err}
+	for i := len(*u) - 1; i >= 0; i-- {
+		step := (*u)[i]
+		if undoErr := step.undo(); undoErr != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s (%s)", step.description, undoErr))
+		} else {
+			report.Undone = append(report.Undone, step.description)
+		}
+	}
+	*u = nil
+	return report
+}
+
+// formAborted converts a form error, treating ctrl+c as backing out.
+func formAborted(err error) error {
+	if errors.Is(err, huh.ErrUserAborted) {
+		return errAborted
+	}
+	return err
+}
+
+// missing is returned when a required value was left empty. In the menu it
+// means the user backed out. Subcommands fail and name the flags to set.
+func missing(flags ...string) error {
+	if !scripted {
+		return errAborted
+	}
+	return &UsageError{"Missing required flag(s): --" + strings.Join(flags, ", --")}
+}
+
+// declined is returned when a confirmation was answered with no
+func declined() error {
+	if !scripted {
+		return errAborted
+	}
+	return errDeclined
+}
+
+// exit is the one place the program ends after running an action. It prints
+// err and decides the exit code.
+func exit(err error) {
+	if err == nil {
+		os.Exit(0)
+	}
+
+	var usageErr *UsageError
+	switch {
+	case errors.Is(err, errAborted):
+		printInBox("Buh bye!")
+		os.Exit(0)
+	case errors.Is(err, errUpdated):
+		os.Exit(0)
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(os.Stderr, usageErr.Message)
+		os.Exit(2)
+	}
+
+	printInBox(renderError(err))
+	os.Exit(1)
+}
+
+func renderError(err error) string {
+	var sb strings.Builder
+	bold := lipgloss.NewStyle().Bold(true)
+
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		fmt.Fprintf(&sb, "%s %s", bold.Render("Step failed:"), stepErr.Step)
+		if stepErr.Command != "" {
+			fmt.Fprintf(&sb, "\n\nCommand:   %s", stepErr.Command)
+		}
+		if stepErr.ExitCode >= 0 {
+			fmt.Fprintf(&sb, "\nExit code: %d", stepErr.ExitCode)
+		}
+		if stepErr.Output != "" {
+			fmt.Fprintf(&sb, "\n\n%s", stepErr.Output)
+		} else {
+			fmt.Fprintf(&sb, "\n\n%s", stepErr.Err)
+		}
+	} else {
+		fmt.Fprintf(&sb, "Command failed with error:\n\n%s", strings.TrimSpace(err.Error()))
+	}
+
+	var rollbackErr *RollbackError
+	if errors.As(err, &rollbackErr) {
+		if len(rollbackErr.Undone) > 0 {
+			fmt.Fprintf(&sb, "\n\n%s\n- %s", bold.Render("Rolled back:"), strings.Join(rollbackErr.Undone, "\n- "))
+		}
+		if len(rollbackErr.Failed) > 0 {
+			fmt.Fprintf(&sb, "\n\n%s\n- %s", bold.Render("Could not roll back:"), strings.Join(rollbackErr.Failed, "\n- "))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestUndoStackRollback(t *testing.T) {
+	var ran []string
+	var undo undoStack
+	undo.push("first", func() error {
+		ran = append(ran, "first")
+		return nil
+	})
+	undo.push("second", func() error {
+		ran = append(ran, "second")
+		return errors.New("busy")
+	})
+	undo.push("third", func() error {
+		ran = append(ran, "third")
+		return nil
+	})
+
+	failed := errors.New("step failed")
+	err := undo.rollback(failed)
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, want the original error", err)
+	}
+	if want := []string{"third", "second", "first"}; !slices.Equal(ran, want) {
+		t.Errorf("ran %q, want %q", ran, want)
+	}
+	var report *RollbackError
+	if !errors.As(err, &report) {
+		t.Fatalf("got %T, want a rollback report", err)
+	}
+	if want := []string{"third", "first"}; !slices.Equal(report.Undone, want) {
+		t.Errorf("undone %q, want %q", report.Undone, want)
+	}
+	if want := []string{"second (busy)"}; !slices.Equal(report.Failed, want) {
+		t.Errorf("failed %q, want %q", report.Failed, want)
+	}
+
+	// the stack is emptied, so a second rollback undoes nothing
+	ran = nil
+	if err := undo.rollback(failed); err != failed || len(ran) > 0 {
+		t.Errorf("second rollback returned %v and ran %q", err, ran)
+	}
+}
+
+func TestUndoStackRollbackWithoutError(t *testing.T) {
+	var undo undoStack
+	undo.push("step", func() error {
+		t.Error("undid a step of a successful action")
+		return nil
+	})
+	if err := undo.rollback(nil); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
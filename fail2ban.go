@@ -0,0 +1,455 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// fail2banClient runs fail2ban-client in the fail2ban container.
+func fail2banClient(args ...string) *Cmd {
+	return command("docker", append([]string{"exec", "fail2ban", "fail2ban-client"}, args...)...)
+}
+
+// JailStatus is the status of a fail2ban jail.
+type JailStatus struct {
+	Name            string   `json:"name"`
+	CurrentlyFailed int      `json:"currently_failed"`
+	TotalFailed     int      `json:"total_failed"`
+	CurrentlyBanned int      `json:"currently_banned"`
+	TotalBanned     int      `json:"total_banned"`
+	BannedIPs       []string `json:"banned_ips"`
+}
+
+// parseFail2banFields reads the "key: value" lines of fail2ban-client's
+// tree shaped output into a map with lower case keys.
+func parseFail2banFields(output string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimLeft(line, "|`- \t")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// ParseJailList reads the jail names from `fail2ban-client status`.
+func ParseJailList(output string) []string {
+	list := parseFail2banFields(output)["jail list"]
+	var jails []string
+	for _, jail := range strings.Split(list, ",") {
+		if jail = strings.TrimSpace(jail); jail != "" {
+			jails = append(jails, jail)
+		}
+	}
+	return jails
+}
+
+// ParseJailStatus reads the output of `fail2ban-client status <jail>`.
+func ParseJailStatus(output string) (JailStatus, error) {
+	fields := parseFail2banFields(output)
+	status := JailStatus{Name: fields["status for the jail"], BannedIPs: strings.Fields(fields["banned ip list"])}
+	if status.Name == "" {
+		return status, fmt.Errorf("not a jail status: %q", strings.TrimSpace(output))
+	}
+	for key, value := range map[string]*int{
+		"currently failed": &status.CurrentlyFailed,
+		"total failed":     &status.TotalFailed,
+		"currently banned": &status.CurrentlyBanned,
+		"total banned":     &status.TotalBanned,
+	} {
+		n, err := strconv.Atoi(fields[key])
+		if err != nil {
+			return status, fmt.Errorf("jail %s: %s: %w", status.Name, key, err)
+		}
+		*value = n
+	}
+	return status, nil
+}
+
+// Fail2banJails returns the names of the running jails.
+func Fail2banJails() ([]string, error) {
+	output, err := fail2banClient("status").ReadOnly().OutputStep("List jails")
+	if err != nil {
+		return nil, err
+	}
+	return ParseJailList(string(output)), nil
+}
+
+// Fail2banStatus returns the status of every jail.
+func Fail2banStatus() ([]JailStatus, error) {
+	jails, err := Fail2banJails()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]JailStatus, 0, len(jails))
+	for _, jail := range jails {
+		output, err := fail2banClient("status", jail).ReadOnly().OutputStep("Get status of " + jail)
+		if err != nil {
+			return nil, err
+		}
+		status, err := ParseJailStatus(string(output))
+		if err != nil {
+			return nil, stepFailed("Get status of "+jail, err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// bannedJails maps each banned IP to the jails that banned it.
+func bannedJails(statuses []JailStatus) map[string][]string {
+	banned := make(map[string][]string)
+	for _, status := range statuses {
+		for _, ip := range status.BannedIPs {
+			banned[ip] = append(banned[ip], status.Name)
+		}
+	}
+	return banned
+}
+
+var fail2banStatusArgs struct {
+	json bool
+}
+
+func fail2banStatusFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&fail2banStatusArgs.json, "json", false, "print as JSON")
+}
+
+func fail2banStatus() error {
+	var statuses []JailStatus
+	err := spin("Reading fail2ban status...", func() error {
+		var err error
+		statuses, err = Fail2banStatus()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if fail2banStatusArgs.json {
+		return printJSON(statuses)
+	}
+
+	var total JailStatus
+	rows := make([][]string, 0, len(statuses)+1)
+	for _, status := range statuses {
+		total.CurrentlyFailed += status.CurrentlyFailed
+		total.TotalFailed += status.TotalFailed
+		total.CurrentlyBanned += status.CurrentlyBanned
+		total.TotalBanned += status.TotalBanned
+		rows = append(rows, []string{
+			status.Name,
+			fmt.Sprintf("%d / %d", status.CurrentlyFailed, status.TotalFailed),
+			fmt.Sprintf("%d / %d", status.CurrentlyBanned, status.TotalBanned),
+			orDash(strings.Join(status.BannedIPs, "\n")),
+		})
+	}
+	rows = append(rows, []string{
+		"Total",
+		fmt.Sprintf("%d / %d", total.CurrentlyFailed, total.TotalFailed),
+		fmt.Sprintf("%d / %d", total.CurrentlyBanned, total.TotalBanned),
+		"",
+	})
+	fmt.Println(renderTable([]string{"Jail", "Failed (now / total)", "Banned (now / total)", "Banned IPs"}, rows))
+	return nil
+}
+
+var unbanIpArgs struct {
+	ip string
+}
+
+func unbanIpFlags(fs *flag.FlagSet) {
+	fs.StringVar(&unbanIpArgs.ip, "ip", "", "IP address to unban")
+}
+
+func unbanIp() error {
+	var statuses []JailStatus
+	err := spin("Reading banned IPs...", func() error {
+		var err error
+		statuses, err = Fail2banStatus()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	allJails := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		allJails = append(allJails, status.Name)
+	}
+
+	var ips []string
+	if unbanIpArgs.ip != "" {
+		ips = []string{unbanIpArgs.ip}
+	}
+
+	// pick from the banned IPs, or type one when nothing is banned
+	banned := bannedJails(statuses)
+	if len(banned) > 0 {
+		addresses := make([]string, 0, len(banned))
+		for ip := range banned {
+			addresses = append(addresses, ip)
+		}
+		sort.Strings(addresses)
+		options := make([]huh.Option[string], 0, len(addresses))
+		for _, ip := range addresses {
+			options = append(options, huh.NewOption(ip+" ("+strings.Join(banned[ip], ", ")+")", ip))
+		}
+		err = prompt(huh.NewMultiSelect[string]().
+			Title("Select IPs to unban").
+			Options(options...).
+			Value(&ips))
+	} else {
+		var ip string
+		err = prompt(huh.NewInput().
+			Title("Enter IP to unban").
+			Description("No IPs are banned right now.").
+			Validate(func(s string) error {
+				if s == "" {
+					return fmt.Errorf("IP address cannot be empty")
+				}
+				return nil
+			}).
+			Value(&ip))
+		if ip != "" {
+			ips = []string{ip}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(ips) == 0 {
+		return missing("ip")
+	}
+
+	err = spin("Unbanning IP...", func() error {
+		for _, ip := range ips {
+			// an IP that isn't banned right now is unbanned everywhere
+			jails := banned[ip]
+			if len(jails) == 0 {
+				jails = allJails
+			}
+			for _, jail := range jails {
+				// docker exec fail2ban sh -c "fail2ban-client set $jail unbanip $ip"
+				_, err := fail2banClient("set", jail, "unbanip", ip).Step("Unban IP in " + jail)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	printInBox(fmt.Sprintf("Unbanned %s. Don't forget to whitelist and have a super day!", strings.Join(ips, ", ")))
+	return nil
+}
+
+// IPs banned permanently are listed in a file that the boost-permanent jail
+// reads, so they are banned again even if fail2ban's database is lost.
+// <SUBNET> matches both addresses and CIDR ranges.
+const permanentJail = "boost-permanent"
+
+const permanentJailFilter = `[Definition]
+failregex = ^<SUBNET>\s*$
+ignoreregex =
+datepattern = {NONE}
+`
+
+const permanentJailSection = `[boost-permanent]
+enabled = true
+filter = boost-permanent
+logpath = /data/boost-permanent.list
+maxretry = 1
+bantime = -1
+`
+
+// banPermanently adds an IP to the boost-permanent jail's list, setting
+// the jail up in jail.local the first time.
+func banPermanently(undo *undoStack, ip string) error {
+	listPath := fail2banDataPath() + "/" + permanentJail + ".list"
+	output, err := sudoCommand("sh", "-c", "cat "+shellQuote(listPath)+" 2>/dev/null || true").ReadOnly().OutputStep("Read permanent bans")
+	if err != nil {
+		return err
+	}
+	listed := string(output)
+	if !slices.ContainsFunc(strings.Fields(listed), func(entry string) bool {
+		return whitelistKey(entry) == whitelistKey(ip)
+	}) {
+		if listed != "" && !strings.HasSuffix(listed, "\n") {
+			listed += "\n"
+		}
+		if err := sudoWriteFile(listPath, listed+ip+"\n", "Add to permanent bans"); err != nil {
+			return err
+		}
+		undo.push("Removed "+ip+" from permanent bans", func() error {
+			return sudoWriteFile(listPath, string(output), "Restore permanent bans")
+		})
+	}
+
+	// filters written by older versions only matched single addresses
+	filterPath := fail2banDataPath() + "/filter.d/" + permanentJail + ".conf"
+	oldFilter, err := sudoCommand("sh", "-c", "cat "+shellQuote(filterPath)+" 2>/dev/null || true").ReadOnly().OutputStep("Read " + permanentJail + " filter")
+	if err != nil {
+		return err
+	}
+	if string(oldFilter) != permanentJailFilter {
+		if _, err := sudoCommand("mkdir", "-p", fail2banDataPath()+"/filter.d").Step("Create filter folder"); err != nil {
+			return err
+		}
+		if err := sudoWriteFile(filterPath, permanentJailFilter, "Write "+permanentJail+" filter"); err != nil {
+			return err
+		}
+		if len(oldFilter) == 0 {
+			undo.push("Removed "+permanentJail+" filter", func() error {
+				_, err := sudoCommand("rm", "-f", filterPath).Step("Remove " + permanentJail + " filter")
+				return err
+			})
+		} else {
+			undo.push("Restored "+permanentJail+" filter", func() error {
+				return sudoWriteFile(filterPath, string(oldFilter), "Restore "+permanentJail+" filter")
+			})
+		}
+	}
+
+	j, err := ReadJailLocal()
+	if err != nil {
+		return err
+	}
+	if j.HasSection(permanentJail) {
+		return nil
+	}
+	j.AddSection(permanentJailSection)
+	return updateJailLocal(undo, j)
+}
+
+var banIpArgs struct {
+	ip        string
+	jail      string
+	permanent bool
+}
+
+func banIpFlags(fs *flag.FlagSet) {
+	fs.StringVar(&banIpArgs.ip, "ip", "", "IP address or CIDR range to ban")
+	fs.StringVar(&banIpArgs.jail, "jail", "", "jail to ban in (default all jails)")
+	fs.BoolVar(&banIpArgs.permanent, "permanent", false, "keep the IP banned for good in the "+permanentJail+" jail")
+}
+
+func banIp() error {
+	var jails []string
+	err := spin("Reading jails...", func() error {
+		var err error
+		jails, err = Fail2banJails()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the permanent jail is only banned in on purpose
+	jails = slices.DeleteFunc(jails, func(jail string) bool { return jail == permanentJail })
+
+	ip := banIpArgs.ip
+	jail := banIpArgs.jail
+	permanent := banIpArgs.permanent
+
+	jailOptions := []huh.Option[string]{huh.NewOption("All jails", "")}
+	for _, name := range jails {
+		jailOptions = append(jailOptions, huh.NewOption(name, name))
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Enter IP to ban").
+				Description("An IP address or a CIDR range like 203.0.113.0/24.").
+				Validate(ValidateAddress).
+				Value(&ip),
+
+			huh.NewSelect[string]().
+				Title("Select jail").
+				Options(jailOptions...).
+				Value(&jail),
+
+			huh.NewConfirm().
+				Title("Ban permanently?").
+				Description("The IP is added to the "+permanentJail+" jail in jail.local and never expires.").
+				Value(&permanent),
+		),
+	)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if ip == "" {
+		return missing("ip")
+	}
+	if err := ValidateAddress(ip); err != nil {
+		return &UsageError{err.Error()}
+	}
+	targets := jails
+	if jail != "" {
+		if !slices.Contains(jails, jail) {
+			return &UsageError{fmt.Sprintf("unknown jail %q, use one of %s", jail, strings.Join(jails, ", "))}
+		}
+		targets = []string{jail}
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	// fail2ban ignores bans of whitelisted addresses
+	j, err := ReadJailLocal()
+	if err != nil {
+		return err
+	}
+	if existing := j.Covering(ip); existing != "" {
+		return &UsageError{fmt.Sprintf("%s is whitelisted by %s, remove it from the whitelist first", ip, existing)}
+	}
+
+	var undo undoStack
+
+	err = spin("Banning IP...", func() error {
+		if permanent {
+			// runs last on rollback, after the files are put back
+			undo.push("Reloaded fail2ban", func() error {
+				_, err := fail2banClient("reload").Step("Reload fail2ban")
+				return err
+			})
+			if err := banPermanently(&undo, ip); err != nil {
+				return err
+			}
+			if _, err := fail2banClient("reload").Step("Reload fail2ban"); err != nil {
+				return err
+			}
+			targets = append(targets, permanentJail)
+		}
+		for _, jail := range targets {
+			_, err := fail2banClient("set", jail, "banip", ip).Step("Ban IP in " + jail)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
+
+	message := fmt.Sprintf("Banned %s in %s.", ip, strings.Join(targets, ", "))
+	if permanent {
+		message += " It stays banned until removed from " + permanentJail + ".list."
+	}
+	printInBox(message + " Have a safe day!")
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJailList(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{"two jails", "Status\n|- Number of jail:\t2\n`- Jail list:\tsshd, wordpress\n", []string{"sshd", "wordpress"}},
+		{"one jail", "Status\n|- Number of jail:\t1\n`- Jail list:\tsshd\n", []string{"sshd"}},
+		{"no jails", "Status\n|- Number of jail:\t0\n`- Jail list:\t\n", nil},
+		{"not a status", "ERROR  Failed to access socket path\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseJailList(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJailStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    JailStatus
+		wantErr bool
+	}{
+		{
+			name: "banned IPs",
+			output: "Status for the jail: sshd\n" +
+				"|- Filter\n" +
+				"|  |- Currently failed:\t3\n" +
+				"|  |- Total failed:\t120\n" +
+				"|  `- File list:\t/var/log/auth.log\n" +
+				"`- Actions\n" +
+				"   |- Currently banned:\t2\n" +
+				"   |- Total banned:\t14\n" +
+				"   `- Banned IP list:\t1.2.3.4 5.6.7.8\n",
+			want: JailStatus{Name: "sshd", CurrentlyFailed: 3, TotalFailed: 120, CurrentlyBanned: 2, TotalBanned: 14, BannedIPs: []string{"1.2.3.4", "5.6.7.8"}},
+		},
+		{
+			name: "nothing banned",
+			output: "Status for the jail: wordpress\n" +
+				"|- Filter\n" +
+				"|  |- Currently failed:\t0\n" +
+				"|  |- Total failed:\t0\n" +
+				"|  `- File list:\t/var/log/caddy/access.log\n" +
+				"`- Actions\n" +
+				"   |- Currently banned:\t0\n" +
+				"   |- Total banned:\t0\n" +
+				"   `- Banned IP list:\t\n",
+			// an empty list, so JSON shows [] rather than null
+			want: JailStatus{Name: "wordpress", BannedIPs: []string{}},
+		},
+		{
+			name:    "unknown jail",
+			output:  "Sorry but the jail 'nope' does not exist\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing count",
+			output:  "Status for the jail: sshd\n|- Filter\n|  |- Currently failed:\t3\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJailStatus(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// mysqlHostArgs turns a WordPress DB_HOST value into mysql client flags.
+// DB_HOST can be a host, host:port or host:/path/to/socket.
+func mysqlHostArgs(dbHost string) []string {
+	host, rest, found := strings.Cut(dbHost, ":")
+	if host == "" {
+		host = "localhost"
+	}
+	args := []string{"-h", host}
+	switch {
+	case !found || rest == "":
+	case strings.HasPrefix(rest, "/"):
+		args = append(args, "--socket="+rest)
+	default:
+		args = append(args, "-P", rest)
+	}
+	return args
+}
+
+// remoteDumpScript returns a shell command that writes the database of the
+// WordPress install at path to stdout. method is wp, mysqldump or auto to
+// use wp-cli when the remote has it.
+func remoteDumpScript(path, method string, values map[string]string) string {
+	wp := "wp db export - --allow-root --quiet"
+	// the password comes from mysqlOptionFile on stdin, so it isn't in the
+	// remote process list. The option file has to be the first flag.
+	args := append([]string{"mysqldump", "--defaults-extra-file=/dev/stdin", "--single-transaction", "--routines", "--triggers"}, mysqlHostArgs(values["DB_HOST"])...)
+	args = append(args, "-u", values["DB_USER"], values["DB_NAME"])
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	mysqldump := strings.Join(args, " ")
+
+	script := "cd " + shellQuote(path) + " && "
+	switch method {
+	case "wp":
+		return script + wp
+	case "mysqldump":
+		return script + mysqldump
+	default:
+		return script + "if command -v wp >/dev/null 2>&1; then " + wp + "; else " + mysqldump + "; fi"
+	}
+}
+
+// mysqlOptionFile returns a mysql option file with the database password
+// for remoteDumpScript to read from stdin.
+func mysqlOptionFile(values map[string]string) string {
+	password := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(values["DB_PASSWORD"])
+	return "[client]\npassword=\"" + password + "\"\n"
+}
+
+var migrateSiteArgs = struct {
+	host            string
+	path            string
+	oldDomain       string
+	method          string
+	exclude         stringList
+	defaultExcludes bool
+	verify          bool
+}{method: "auto", defaultExcludes: true, verify: true}
+
+func migrateSiteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&migrateSiteArgs.host, "host", "", "source host from /root/.ssh/config")
+	fs.StringVar(&migrateSiteArgs.path, "path", "", "WordPress folder on the source host")
+	fs.StringVar(&migrateSiteArgs.oldDomain, "old-domain", "", "domain of the source site")
+	fs.StringVar(&migrateSiteArgs.method, "method", "auto", "dump with wp, mysqldump or auto")
+	fs.Var(&migrateSiteArgs.exclude, "exclude", "rsync exclude pattern, can be repeated")
+	fs.BoolVar(&migrateSiteArgs.defaultExcludes, "default-excludes", true, "skip "+strings.Join(defaultMigrateExcludes, ", "))
+	fs.BoolVar(&migrateSiteArgs.verify, "verify", true, "compare checksums after the transfer")
+}
+
+func migrateSite() error {
+	switch migrateSiteArgs.method {
+	case "auto", "wp", "mysqldump":
+	default:
+		return &UsageError{fmt.Sprintf("unknown --method %q, use auto, wp or mysqldump", migrateSiteArgs.method)}
+	}
+
+	siteDir := sitePath(chosenSite)
+	wpConfig := siteDir + "/wordpress/wp-config.php"
+
+	// the local database details survive the copy of the remote wp-config.php
+	local, err := ReadDefineValues(wpConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return stepFailed("Read local wp-config.php", fmt.Errorf("%s has no wp-config.php, create the site with a database first", chosenSite))
+	}
+	if err != nil {
+		return stepFailed("Read local wp-config.php", err)
+	}
+	for _, key := range []string{"DB_NAME", "DB_USER", "DB_PASSWORD"} {
+		if local[key] == "" {
+			return stepFailed("Read local wp-config.php", fmt.Errorf("%s not found in %s", key, wpConfig))
+		}
+	}
+	if local["DB_HOST"] == "" {
+		local["DB_HOST"] = "mariadb"
+	}
+
+	compose, err := ReadComposeFile(siteDir + "/docker-compose.yml")
+	if err != nil {
+		return stepFailed("Read docker-compose.yml", err)
+	}
+	domains, _ := compose.Label("wordpress", "caddy")
+	newDomain := firstDomain(domains)
+
+	hosts, err := GetHostsFromSSHConfig("/root/.ssh/config", true)
+	if err != nil || len(hosts) == 0 {
+		return stepFailed("Read SSH config", fmt.Errorf("no hosts found in SSH config.\n\nPlease add to /root/.ssh/config and try again"))
+	}
+
+	sourceHost := migrateSiteArgs.host
+	sourcePath := migrateSiteArgs.path
+	oldDomain := migrateSiteArgs.oldDomain
+	verify := migrateSiteArgs.verify
+	var excludes []string
+	if migrateSiteArgs.defaultExcludes {
+		excludes = append(excludes, defaultMigrateExcludes...)
+	}
+	excludes = append(excludes, migrateSiteArgs.exclude...)
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select source host").
+				Options(sshHostOptions(hosts)...).
+				Value(&sourceHost),
+
+			huh.NewInput().
+				Title("Enter WordPress folder on the source host").
+				Description("The folder with wp-config.php in it.").
+				Validate(func(s string) error {
+					if s == "" || !strings.HasPrefix(s, "/") {
+						return fmt.Errorf("please enter a full path")
+					}
+					return nil
+				}).
+				Value(&sourcePath),
+
+			huh.NewInput().
+				Title("Enter domain of the source site").
+				Description("Replaced with "+newDomain+" in the database.").
+				Validate(ValidateDomains).
+				Value(&oldDomain),
+
+			huh.NewMultiSelect[string]().
+				Title("Skip").
+				Options(huh.NewOptions(defaultMigrateExcludes...)...).
+				Value(&excludes),
+
+			huh.NewConfirm().
+				Title("Compare checksums after the transfer").
+				Value(&verify),
+		),
+	)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if sourceHost == "" || !strings.HasPrefix(sourcePath, "/") || oldDomain == "" {
+		return missing("host", "path", "old-domain")
+	}
+	if err := checkSSHHost(hosts, sourceHost); err != nil {
+		return err
+	}
+	// the domain ends up in a shell command
+	if err := ValidateDomains(oldDomain); err != nil {
+		return &UsageError{fmt.Sprintf("invalid --old-domain: %s", err)}
+	}
+	oldDomain = firstDomain(oldDomain)
+	sourcePath = strings.TrimSuffix(sourcePath, "/")
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	// read database details from the remote wp-config.php
+	output, err := sudoCommand("ssh", sourceHost, "cat "+shellQuote(sourcePath+"/wp-config.php")).ReadOnly().OutputStep("Read remote wp-config.php")
+	if err != nil {
+		return err
+	}
+	remote := ParseDefineValues(string(output))
+	if remote["DB_NAME"] == "" || remote["DB_USER"] == "" {
+		return stepFailed("Read remote wp-config.php", fmt.Errorf("DB_NAME or DB_USER not found"))
+	}
+
+	var confirmed bool
+	confirm(
+		"Everything look good?",
+		fmt.Sprintf("Source: %s:%s\nDatabase: %s on %s\nDestination: %s\nSkipping: %s\nDomain: %s → %s\n\nFiles and database of %s will be overwritten.",
+			sourceHost, sourcePath, remote["DB_NAME"], orDash(remote["DB_HOST"]), siteDir+"/wordpress/", orDash(strings.Join(excludes, ", ")), oldDomain, newDomain, chosenSite),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	if err := rsyncFromHost(sourceHost+":"+sourcePath+"/", siteDir+"/wordpress/", excludes, verify); err != nil {
+		return err
+	}
+
+	err = spin(fmt.Sprintf("Migrating database for %s...", chosenSite), func() error {
+		staging, err := os.MkdirTemp("", "boost-migrate-")
+		if err != nil {
+			return stepFailed("Create temporary folder", err)
+		}
+		defer os.RemoveAll(staging)
+
+		// ssh -C compresses the dump on the way over
+		dump := sudoCommand("ssh", "-C", sourceHost, remoteDumpScript(sourcePath, migrateSiteArgs.method, remote))
+		dump.Stdin = strings.NewReader(mysqlOptionFile(remote))
+		if err := writeDump(dump, "Dump remote database", staging+"/database.sql.gz"); err != nil {
+			return err
+		}
+		if err := ImportDatabase(local["DB_NAME"], staging+"/database.sql.gz"); err != nil {
+			return stepFailed("Import database", err)
+		}
+
+		// the copied wp-config.php still points at the remote database
+		err = UpdateDefineValues(wpConfig, map[string]string{
+			"DB_NAME":     local["DB_NAME"],
+			"DB_USER":     local["DB_USER"],
+			"DB_PASSWORD": local["DB_PASSWORD"],
+			"DB_HOST":     local["DB_HOST"],
+		})
+		if err != nil {
+			return stepFailed("Update wp-config.php", err)
+		}
+
+		if newDomain != "" && oldDomain != newDomain {
+			_, err = wpSearchReplace(chosenSite, oldDomain, newDomain).Step("Search and replace domain")
+			if err != nil {
+				return err
+			}
+		}
+
+		return runFixPermissions()
+	})
+	if err != nil {
+		return err
+	}
+
+	printInBox("Site migrated. Have a spectacular day!")
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// never synced between sites: database credentials and caches differ per site
+var promoteExcludes = []string{"/wp-config.php", "/.maintenance", "/wp-content/cache/"}
+
+var promoteSiteArgs struct {
+	target   string
+	include  stringList
+	exclude  stringList
+	delete   bool
+	database bool
+}
+
+func promoteSiteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&promoteSiteArgs.target, "to", "", "site to promote to")
+	fs.Var(&promoteSiteArgs.include, "include", "rsync include pattern that overrides --exclude, can be repeated")
+	fs.Var(&promoteSiteArgs.exclude, "exclude", "rsync exclude pattern, can be repeated")
+	fs.BoolVar(&promoteSiteArgs.delete, "delete", false, "delete files in the target that aren't in the source")
+	fs.BoolVar(&promoteSiteArgs.database, "db", false, "replace the target database")
+}
+
+// FileChanges summarises an rsync --itemize-changes listing.
+type FileChanges struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+// ParseItemizedChanges reads the output of rsync --itemize-changes. Only
+// files that are sent count, not directories or files that just had their
+// times or permissions updated.
+func ParseItemizedChanges(output string) FileChanges {
+	var changes FileChanges
+	for _, line := range strings.Split(output, "\n") {
+		flags, path, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		path = strings.TrimSpace(path)
+		switch {
+		case flags == "*deleting":
+			changes.Deleted = append(changes.Deleted, path)
+		case len(flags) != 11 || flags[0] != '>' || flags[1] != 'f':
+			// not a file being sent
+		case strings.HasPrefix(flags[2:], "+++"):
+			changes.Created = append(changes.Created, path)
+		default:
+			changes.Updated = append(changes.Updated, path)
+		}
+	}
+	return changes
+}
+
+// rsyncFilters turns include and exclude patterns into rsync arguments.
+// Includes come first so they win over the excludes. They only override
+// excludes: without a catch-all like --exclude='*' everything else is still
+// copied.
+func rsyncFilters(include, exclude []string) []string {
+	var args []string
+	for _, pattern := range include {
+		args = append(args, "--include="+pattern)
+	}
+	for _, pattern := range exclude {
+		args = append(args, "--exclude="+pattern)
+	}
+	return args
+}
+
+func promoteSite() error {
+	source := chosenSite
+	target := promoteSiteArgs.target
+	include := promoteSiteArgs.include
+	exclude := promoteSiteArgs.exclude
+	deleteFiles := promoteSiteArgs.delete
+	replaceDb := promoteSiteArgs.database
+
+	var targets []string
+	for _, site := range GetDirectoriesInPath("/home/" + USER + "/sites") {
+		if site != source {
+			targets = append(targets, site)
+		}
+	}
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Promote "+source+" to which site?").
+				Options(huh.NewOptions(targets...)...).
+				Value(&target),
+
+			huh.NewConfirm().
+				Title("Delete files missing from "+source).
+				Value(&deleteFiles),
+
+			huh.NewConfirm().
+				Title("Replace the database").
+				Description("The target's database is replaced with a copy of "+source+"'s.").
+				Value(&replaceDb),
+		),
+	)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	if target == "" {
+		return missing("to")
+	}
+	if target == source {
+		return &UsageError{"can't promote a site to itself"}
+	}
+	if !SiteExists(target) {
+		return &UsageError{fmt.Sprintf("site %q not found in /home/%s/sites", target, USER)}
+	}
+
+	var sourceDb, targetDb string
+	if replaceDb {
+		var err error
+		if sourceDb, err = SiteDatabase(source); err != nil {
+			return stepFailed("Find database for "+source, err)
+		}
+		if targetDb, err = SiteDatabase(target); err != nil {
+			return stepFailed("Find database for "+target, err)
+		}
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+
+	sourceFiles := sitePath(source) + "/wordpress/"
+	targetFiles := sitePath(target) + "/wordpress/"
+	// the first matching rule wins, so the files promote never copies are
+	// excluded before any of the user's includes can match them
+	rsyncArgs := append([]string{"-a"}, rsyncFilters(nil, promoteExcludes)...)
+	rsyncArgs = append(rsyncArgs, rsyncFilters(include, exclude)...)
+	if deleteFiles {
+		rsyncArgs = append(rsyncArgs, "--delete")
+	}
+
+	// preview: rsync --dry-run doesn't change anything
+	var changes FileChanges
+	var sourceCounts, targetCounts map[string]int64
+	err := spin("Comparing sites...", func() error {
+		output, err := sudoCommand("rsync", append(append([]string{"--dry-run", "--itemize-changes"}, rsyncArgs...), sourceFiles, targetFiles)...).ReadOnly().OutputStep("Compare files")
+		if err != nil {
+			return err
+		}
+		changes = ParseItemizedChanges(string(output))
+		if replaceDb {
+			if sourceCounts, err = TableRowCounts(sourceDb); err != nil {
+				return err
+			}
+			if targetCounts, err = TableRowCounts(targetDb); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(renderFileChanges(changes))
+	if replaceDb {
+		fmt.Println(renderRowCounts(source, target, sourceCounts, targetCounts))
+	}
+
+	confirmed := false
+	confirm(
+		fmt.Sprintf("Promote %s to %s?", source, target),
+		fmt.Sprintf("%d new, %d updated and %d deleted files. %s is backed up first.", len(changes.Created), len(changes.Updated), len(changes.Deleted), target),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+
+	var backup BackupFile
+	err = spin("Backing up "+target+"...", func() error {
+		var err error
+		backup, err = BackupSite(target, config.BackupsDir, config.BackupFormat)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = spin(fmt.Sprintf("Promoting %s to %s...", source, target), func() error {
+		_, err := sudoCommand("rsync", append(rsyncArgs, sourceFiles, targetFiles)...).Step("Sync files")
+		if err != nil {
+			return err
+		}
+
+		if replaceDb {
+			if err := replaceDatabase(sourceDb, targetDb); err != nil {
+				return err
+			}
+			err = replaceSiteDomain(source, target)
+			if err != nil {
+				return err
+			}
+		}
+
+		return fixSitePermissions(target)
+	})
+	if err != nil {
+		printInBox(fmt.Sprintf("%s was backed up before promoting to\n%s", target, backup.Path))
+		return err
+	}
+
+	printInBox(fmt.Sprintf("Promoted %s to %s.\nBackup of the old %s: %s\n\nHave a triumphant day!", source, target, target, backup.Path))
+	return nil
+}
+
+// replaceDatabase swaps the contents of targetDb for a copy of sourceDb.
+// Dropping and recreating the database keeps its grants.
+func replaceDatabase(sourceDb, targetDb string) error {
+	staging, err := os.MkdirTemp("", "boost-promote-")
+	if err != nil {
+		return stepFailed("Create temporary folder", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := DumpDatabase(sourceDb, staging+"/database.sql.gz"); err != nil {
+		return stepFailed("Dump database "+sourceDb, err)
+	}
+	_, err = mariadbQuery("DROP DATABASE $DB_NAME; CREATE DATABASE $DB_NAME;", "DB_NAME="+targetDb).Step("Empty database " + targetDb)
+	if err != nil {
+		return err
+	}
+	if err := ImportDatabase(targetDb, staging+"/database.sql.gz"); err != nil {
+		return stepFailed("Import database", err)
+	}
+	return nil
+}
+
+// replaceSiteDomain swaps the source site's domain for the target's in the
+// target's database.
+func replaceSiteDomain(source, target string) error {
+	read := func(site string) (string, error) {
+		compose, err := ReadComposeFile(sitePath(site) + "/docker-compose.yml")
+		if err != nil {
+			return "", err
+		}
+		domains, _ := compose.Label("wordpress", "caddy")
+		return firstDomain(domains), nil
+	}
+	oldUrl, err := read(source)
+	if err != nil {
+		return stepFailed("Read domain of "+source, err)
+	}
+	newUrl, err := read(target)
+	if err != nil {
+		return stepFailed("Read domain of "+target, err)
+	}
+	if oldUrl == "" || newUrl == "" || oldUrl == newUrl {
+		return nil
+	}
+	_, err = wpSearchReplace(target, oldUrl, newUrl).Step("Search and replace domain")
+	return err
+}
+
+// number of paths listed for each kind of change
+const changesListed = 10
+
+func renderFileChanges(changes FileChanges) string {
+	var sb strings.Builder
+	list := func(title string, color string, paths []string) {
+		fmt.Fprintf(&sb, "%s %d\n", lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(color)).Render(title), len(paths))
+		for i, path := range paths {
+			if i == changesListed {
+				fmt.Fprintf(&sb, "  … and %d more\n", len(paths)-changesListed)
+				break
+			}
+			fmt.Fprintf(&sb, "  %s\n", path)
+		}
+	}
+	list("New files:", "42", changes.Created)
+	list("Updated files:", "220", changes.Updated)
+	list("Deleted files:", "160", changes.Deleted)
+	return strings.TrimSpace(sb.String())
+}
+
+func renderRowCounts(source, target string, sourceCounts, targetCounts map[string]int64) string {
+	tables := make(map[string]bool)
+	for table := range sourceCounts {
+		tables[table] = true
+	}
+	for table := range targetCounts {
+		tables[table] = true
+	}
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "No tables in either database."
+	}
+
+	count := func(counts map[string]int64, table string) string {
+		if n, ok := counts[table]; ok {
+			return strconv.FormatInt(n, 10)
+		}
+		return "-"
+	}
+	changed := lipgloss.NewStyle().Foreground(lipgloss.Color("220"))
+	rows := make([][]string, 0, len(names))
+	for _, table := range names {
+		row := []string{table, count(sourceCounts, table), count(targetCounts, table)}
+		if row[1] != row[2] {
+			row[0] = changed.Render(row[0])
+		}
+		rows = append(rows, row)
+	}
+	return renderTable([]string{"Table", source + " rows", target + " rows"}, rows)
+}
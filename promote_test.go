@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseItemizedChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   FileChanges
+	}{
+		{
+			name:   "new, updated and deleted files",
+			output: ".d..t...... ./\n>f+++++++++ new.php\n>f.st...... index.php\n*deleting   old.php\n",
+			want:   FileChanges{Created: []string{"new.php"}, Updated: []string{"index.php"}, Deleted: []string{"old.php"}},
+		},
+		{
+			name:   "checksum change",
+			output: ">fc.t...... wp-content/a.php\n",
+			want:   FileChanges{Updated: []string{"wp-content/a.php"}},
+		},
+		{
+			name:   "spaces in names",
+			output: ">f+++++++++ wp-content/uploads/my photo.jpg\n*deleting   wp-content/old file.txt\n",
+			want:   FileChanges{Created: []string{"wp-content/uploads/my photo.jpg"}, Deleted: []string{"wp-content/old file.txt"}},
+		},
+		{
+			name: "directories, links and attribute changes don't count",
+			output: "cd+++++++++ wp-content/new-plugin/\n" +
+				".f...p..... wp-config-sample.php\n" +
+				".d..t...... wp-content/\n" +
+				"cL+++++++++ current -> releases/1\n",
+			want: FileChanges{},
+		},
+		{
+			name:   "summary lines are ignored",
+			output: "sending incremental file list\n\nsent 1,234 bytes  received 56 bytes\ntotal size is 7,890  speedup is 6.12 (DRY RUN)\n",
+			want:   FileChanges{},
+		},
+		{
+			name:   "nothing",
+			output: "",
+			want:   FileChanges{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseItemizedChanges(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Validate checks that a policy keeps at least one backup.
+func (p RetentionPolicy) Validate() error {
+	if p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 {
+		return fmt.Errorf("retention counts can't be negative")
+	}
+	if p.Daily+p.Weekly+p.Monthly == 0 {
+		return fmt.Errorf("retention policy keeps no backups")
+	}
+	return nil
+}
+
+// ExpiredBackups returns the backups the policy doesn't keep. Each site and
+// kind of backup is handled on its own, so pruning database dumps never
+// touches site archives and one busy site can't push out another's backups.
+func (p RetentionPolicy) ExpiredBackups(backups []BackupFile) []BackupFile {
+	groups := make(map[string][]BackupFile)
+	for _, backup := range backups {
+		key := backup.Site + "/" + backup.Kind
+		groups[key] = append(groups[key], backup)
+	}
+
+	rules := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	var expired []BackupFile
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Created.After(group[j].Created)
+		})
+		keep := make(map[string]bool)
+		for _, rule := range rules {
+			// the newest backup of each period counts, until count periods are covered
+			periods := make(map[string]bool)
+			for _, backup := range group {
+				if len(periods) >= rule.count {
+					break
+				}
+				period := rule.period(backup.Created)
+				if periods[period] {
+					continue
+				}
+				periods[period] = true
+				keep[backup.Path] = true
+			}
+		}
+		for _, backup := range group {
+			if !keep[backup.Path] {
+				expired = append(expired, backup)
+			}
+		}
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		if expired[i].Site != expired[j].Site {
+			return expired[i].Site < expired[j].Site
+		}
+		return expired[i].Created.Before(expired[j].Created)
+	})
+	return expired
+}
+
+var pruneBackupsArgs struct {
+	dir string
+}
+
+func pruneBackupsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&pruneBackupsArgs.dir, "dir", "", "backups directory (default from config)")
+}
+
+func pruneBackups() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return stepFailed("Load config", err)
+	}
+	if err := config.Retention.Validate(); err != nil {
+		return stepFailed("Load config", fmt.Errorf("%s: %w", configPath(), err))
+	}
+	backupsDir := config.BackupsDir
+	if pruneBackupsArgs.dir != "" {
+		backupsDir = pruneBackupsArgs.dir
+	}
+
+	backups, err := ListBackups(backupsDir)
+	if err != nil {
+		return stepFailed("Find backups", err)
+	}
+	expired := config.Retention.ExpiredBackups(backups)
+	if len(expired) == 0 {
+		printInBox(fmt.Sprintf("Nothing to prune in %s. Have a tidy day!", backupsDir))
+		return nil
+	}
+
+	// show everything that would go before asking
+	var total int64
+	rows := make([][]string, 0, len(expired))
+	for _, backup := range expired {
+		total += backup.Size
+		rows = append(rows, []string{backup.Site, filepath.Base(backup.Path), backup.Created.Format("2006-01-02 15:04"), FormatBytes(backup.Size)})
+	}
+	fmt.Println(renderTable([]string{"Site", "Backup", "Created", "Size"}, rows))
+
+	policy := config.Retention
+	confirmed := false
+	confirm(
+		fmt.Sprintf("Delete %d backups (%s)?", len(expired), FormatBytes(total)),
+		fmt.Sprintf("Keeping %d daily, %d weekly and %d monthly backups per site.", policy.Daily, policy.Weekly, policy.Monthly),
+		&confirmed,
+	)
+	if !confirmed {
+		return declined()
+	}
+
+	var freed int64
+	var deleted int
+	for _, backup := range expired {
+		err := do("rm "+backup.Path, func() error {
+			return os.Remove(backup.Path)
+		})
+		if err != nil {
+			return stepFailed("Delete "+backup.Path, fmt.Errorf("%w (deleted %d backups, freed %s before this)", err, deleted, FormatBytes(freed)))
+		}
+		deleted++
+		freed += backup.Size
+	}
+
+	if dryRun {
+		printInBox(fmt.Sprintf("Would delete %d backups and free %s.", deleted, FormatBytes(freed)))
+		return nil
+	}
+	printInBox(fmt.Sprintf("Deleted %d backups and freed %s. Have a spacious day!", deleted, FormatBytes(freed)))
+	return nil
+}
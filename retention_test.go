@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	backup := func(site, kind, created string) BackupFile {
+		t, err := time.Parse("2006-01-02 15:04", created)
+		if err != nil {
+			panic(err)
+		}
+		return BackupFile{Site: site, Kind: kind, Path: site + "/" + kind + "-" + created, Created: t}
+	}
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		backups []BackupFile
+		want    []string
+	}{
+		{
+			name:   "newest of each day",
+			policy: RetentionPolicy{Daily: 2},
+			backups: []BackupFile{
+				backup("shop", "db", "2026-10-17 04:00"),
+				backup("shop", "db", "2026-10-17 10:00"),
+				backup("shop", "db", "2026-10-16 04:00"),
+				backup("shop", "db", "2026-10-15 04:00"),
+			},
+			want: []string{"shop/db-2026-10-15 04:00", "shop/db-2026-10-17 04:00"},
+		},
+		{
+			name:   "days, weeks and months together",
+			policy: RetentionPolicy{Daily: 1, Weekly: 2, Monthly: 2},
+			backups: []BackupFile{
+				backup("shop", "site", "2026-10-17 04:00"),
+				backup("shop", "site", "2026-10-14 04:00"),
+				backup("shop", "site", "2026-10-10 04:00"),
+				backup("shop", "site", "2026-10-03 04:00"),
+				backup("shop", "site", "2026-09-30 04:00"),
+				backup("shop", "site", "2026-09-01 04:00"),
+				backup("shop", "site", "2026-08-31 04:00"),
+				backup("shop", "site", "2026-07-15 04:00"),
+			},
+			// kept: the 17th for the day, the 10th for the week before,
+			// and the 30th of September for the month before
+			want: []string{
+				"shop/site-2026-07-15 04:00",
+				"shop/site-2026-08-31 04:00",
+				"shop/site-2026-09-01 04:00",
+				"shop/site-2026-10-03 04:00",
+				"shop/site-2026-10-14 04:00",
+			},
+		},
+		{
+			name:   "sites and kinds are pruned separately",
+			policy: RetentionPolicy{Daily: 1},
+			backups: []BackupFile{
+				backup("shop", "db", "2026-10-17 04:00"),
+				backup("shop", "db", "2026-10-16 04:00"),
+				backup("shop", "site", "2026-10-10 04:00"),
+				backup("blog", "db", "2026-09-01 04:00"),
+			},
+			want: []string{"shop/db-2026-10-16 04:00"},
+		},
+		{
+			name:   "fewer backups than the policy keeps",
+			policy: RetentionPolicy{Daily: 7, Weekly: 4, Monthly: 6},
+			backups: []BackupFile{
+				backup("shop", "db", "2026-10-17 04:00"),
+				backup("shop", "db", "2026-09-17 04:00"),
+			},
+			want: nil,
+		},
+		{
+			name:   "no backups",
+			policy: RetentionPolicy{Daily: 7},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, backup := range tt.policy.ExpiredBackups(tt.backups) {
+				got = append(got, backup.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy  RetentionPolicy
+		wantErr bool
+	}{
+		{RetentionPolicy{Daily: 7, Weekly: 4, Monthly: 6}, false},
+		{RetentionPolicy{Monthly: 1}, false},
+		{RetentionPolicy{}, true},
+		{RetentionPolicy{Daily: -1, Weekly: 2}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v: got %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// skipped by migrateFiles unless turned off: caches and backup plugin archives
+var defaultMigrateExcludes = []string{"wp-content/cache/", "wp-content/updraft/", "wp-content/ai1wm-backups/"}
+
+// folder rsync keeps interrupted transfers in, so a rerun can resume them
+const rsyncPartialDir = ".rsync-partial"
+
+// RemotePathType stats a path on an ssh host and returns "dir", "file" or
+// "missing".
+func RemotePathType(host, path string) (string, error) {
+	q := shellQuote(path)
+	script := "if [ -d " + q + " ]; then echo dir; elif [ -e " + q + " ]; then echo file; else echo missing; fi"
+	output, err := sudoCommand("ssh", host, script).ReadOnly().OutputStep("Check source path")
+	if err != nil {
+		return "", err
+	}
+	kind := strings.TrimSpace(string(output))
+	switch kind {
+	case "dir", "file", "missing":
+		return kind, nil
+	}
+	return "", stepFailed("Check source path", fmt.Errorf("unexpected answer from %s: %q", host, kind))
+}
+
+// RsyncProgress is a line of rsync --info=progress2 output.
+type RsyncProgress struct {
+	Bytes   int64
+	Percent int
+	Rate    string
+	ETA     string
+}
+
+var progress2Re = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+(\S+)\s+(\d+:\d+:\d+)`)
+
+// ParseRsyncProgress reads a progress2 line like
+// "  1,234,567  45%  1.23MB/s    0:00:12 (xfr#3, to-chk=10/20)".
+func ParseRsyncProgress(line string) (RsyncProgress, bool) {
+	match := progress2Re.FindStringSubmatch(line)
+	if match == nil {
+		return RsyncProgress{}, false
+	}
+	bytes, err := strconv.ParseInt(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+	if err != nil {
+		return RsyncProgress{}, false
+	}
+	percent, _ := strconv.Atoi(match[2])
+	return RsyncProgress{Bytes: bytes, Percent: min(percent, 100), Rate: match[3], ETA: match[4]}, true
+}
+
+// progressBar draws rsync progress on a single line that redraws itself.
+// Lines that aren't progress are printed below it. rsync's errors come in
+// through Errors.
+type progressBar struct {
+	out   io.Writer
+	mu    sync.Mutex
+	line  []byte
+	drawn bool
+}
+
+const progressBarWidth = 30
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range b {
+		if c != '\r' && c != '\n' {
+			p.line = append(p.line, c)
+			continue
+		}
+		p.flush()
+	}
+	return len(b), nil
+}
+
+func (p *progressBar) flush() {
+	line := string(p.line)
+	p.line = p.line[:0]
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	progress, ok := ParseRsyncProgress(line)
+	if !ok {
+		p.endLine()
+		fmt.Fprintln(p.out, line)
+		return
+	}
+	filled := progress.Percent * progressBarWidth / 100
+	bar := lipgloss.NewStyle().Foreground(lipgloss.Color("63")).Render(strings.Repeat("█", filled)) +
+		lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render(strings.Repeat("░", progressBarWidth-filled))
+	fmt.Fprintf(p.out, "\r%s %3d%%  %s  %s  ETA %s\033[K", bar, progress.Percent, FormatBytes(progress.Bytes), progress.Rate, progress.ETA)
+	p.drawn = true
+}
+
+func (p *progressBar) endLine() {
+	if p.drawn {
+		fmt.Fprintln(p.out)
+		p.drawn = false
+	}
+}
+
+// Done ends the progress line.
+func (p *progressBar) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.line) > 0 {
+		p.flush()
+	}
+	p.endLine()
+}
+
+// Errors returns a writer for rsync's stderr that prints to w without
+// drawing over the progress line.
+func (p *progressBar) Errors(w io.Writer) io.Writer {
+	return writerFunc(func(b []byte) (int, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.endLine()
+		return w.Write(b)
+	})
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+// rsyncFromHost copies source, like host:/path/, into destination with a
+// progress bar. Interrupted files are kept so running it again resumes
+// them. With verify, a checksum dry run afterwards makes sure no file
+// still differs.
+func rsyncFromHost(source, destination string, excludes []string, verify bool) error {
+	rsyncArgs := append([]string{"-rtp", "--partial", "--partial-dir=" + rsyncPartialDir}, rsyncFilters(nil, excludes)...)
+	cmd := sudoCommand("rsync", append(append(rsyncArgs, "--info=progress2", "--no-inc-recursive"), source, destination)...)
+	bar := &progressBar{out: os.Stdout}
+	cmd.Stdout = bar
+	cmd.Stderr = bar.Errors(os.Stderr)
+	cmd.Stdin = os.Stdin
+	err := cmd.RunStep("Migrate files")
+	bar.Done()
+	if err != nil {
+		return err
+	}
+
+	if !verify || dryRun {
+		return nil
+	}
+	var changes FileChanges
+	err = spin("Comparing checksums...", func() error {
+		output, err := sudoCommand("rsync", append(append(rsyncArgs, "--checksum", "--dry-run", "--itemize-changes"), source, destination)...).ReadOnly().OutputStep("Compare checksums")
+		changes = ParseItemizedChanges(string(output))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if differ := append(changes.Created, changes.Updated...); len(differ) > 0 {
+		return stepFailed("Compare checksums", fmt.Errorf("%d files differ from the source, run the migration again to resume:\n%s", len(differ), strings.Join(differ[:min(len(differ), changesListed)], "\n")))
+	}
+	return nil
+}
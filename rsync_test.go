@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseRsyncProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   RsyncProgress
+		wantOK bool
+	}{
+		{
+			name:   "while transferring",
+			line:   "     32,768   0%   31.25MB/s    0:00:00 (xfr#1, to-chk=1520/1530)",
+			want:   RsyncProgress{Bytes: 32768, Percent: 0, Rate: "31.25MB/s", ETA: "0:00:00"},
+			wantOK: true,
+		},
+		{
+			name:   "partway",
+			line:   "  1,234,567,890  45%    1.23MB/s    0:12:34",
+			want:   RsyncProgress{Bytes: 1234567890, Percent: 45, Rate: "1.23MB/s", ETA: "0:12:34"},
+			wantOK: true,
+		},
+		{
+			name:   "finished",
+			line:   "    104,857,600 100%   98.62MB/s    0:00:01 (xfr#1530, to-chk=0/1530)",
+			want:   RsyncProgress{Bytes: 104857600, Percent: 100, Rate: "98.62MB/s", ETA: "0:00:01"},
+			wantOK: true,
+		},
+		{
+			name:   "percent over 100 is capped",
+			line:   "        512 101%  500.00kB/s    0:00:00",
+			want:   RsyncProgress{Bytes: 512, Percent: 100, Rate: "500.00kB/s", ETA: "0:00:00"},
+			wantOK: true,
+		},
+		{name: "file list", line: "receiving incremental file list"},
+		{name: "summary", line: "sent 1,234 bytes  received 104,860,001 bytes  41,945,693.20 bytes/sec"},
+		{name: "empty", line: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRsyncProgress(tt.line)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		name string
+		// rsync's stdout, written in one go
+		output string
+		want   []string
+	}{
+		{
+			name:   "progress redraws one line",
+			output: "receiving incremental file list\n     32,768   0%   31.25MB/s    0:00:00\r    104,857,600 100%   98.62MB/s    0:00:01 (xfr#2, to-chk=0/2)\n",
+			want: []string{
+				"receiving incremental file list\n",
+				"\r", "  0%  32.00 KB  31.25MB/s  ETA 0:00:00\033[K",
+				"\r", "100%  100.00 MB  98.62MB/s  ETA 0:00:01\033[K",
+			},
+		},
+		{
+			name:   "other lines go below the bar",
+			output: "  1,024  50%  1.00kB/s  0:00:01\rsent 1,234 bytes  received 2,048 bytes\n",
+			want:   []string{"\r", " 50%  1.00 KB", "\033[K\nsent 1,234 bytes  received 2,048 bytes\n"},
+		},
+		{
+			name:   "line without newline is drawn on Done",
+			output: "  1,024  50%  1.00kB/s  0:00:01",
+			want:   []string{"\r", " 50%  1.00 KB  1.00kB/s  ETA 0:00:01\033[K\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			bar := &progressBar{out: &out}
+			bar.Write([]byte(tt.output))
+			bar.Done()
+			assertInOrder(t, out.String(), tt.want...)
+		})
+	}
+}
+
+func TestProgressBarErrors(t *testing.T) {
+	var out, errs bytes.Buffer
+	bar := &progressBar{out: &out}
+	bar.Write([]byte("  1,024  50%  1.00kB/s  0:00:01\r"))
+	bar.Errors(&errs).Write([]byte("rsync: [sender] send_files failed to open \"/var/www/html/wp-config.php\": Permission denied (13)\n"))
+	bar.Done()
+
+	// the progress line is ended before the error, and only once
+	if got := out.String(); !strings.HasSuffix(got, "\033[K\n") || strings.Count(got, "\n") != 1 {
+		t.Errorf("progress output %q, want the line ended once", got)
+	}
+	if !strings.Contains(errs.String(), "Permission denied") {
+		t.Errorf("error output %q, want rsync's error", errs.String())
+	}
+}
+
+// assertInOrder checks that s contains each of want, in that order.
+func assertInOrder(t *testing.T, s string, want ...string) {
+	t.Helper()
+	rest := s
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i < 0 {
+			t.Errorf("no %q in order in %q", w, s)
+			return
+		}
+		rest = rest[i+len(w):]
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Runner executes commands. All process execution goes through the package
+// level runner so it can be swapped for a dry run or a fake.
+type Runner interface {
+	Run(c *Cmd) error
+	Output(c *Cmd) ([]byte, error)
+	CombinedOutput(c *Cmd) ([]byte, error)
+	// Do performs a change that doesn't spawn a process, like writing a file.
+	Do(description string, fn func() error) error
+}
+
+var runner Runner = ExecRunner{}
+
+// true when --dry-run is set
+var dryRun bool
+
+// Cmd describes a command to run. Build one with command or sudoCommand.
+type Cmd struct {
+	name     string
+	args     []string
+	env      []string
+	sudo     bool
+	readOnly bool
+	secrets  []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func command(name string, args ...string) *Cmd {
+	return &Cmd{name: name, args: args}
+}
+
+func sudoCommand(name string, args ...string) *Cmd {
+	return &Cmd{name: name, args: args, sudo: true}
+}
+
+// WithEnv adds KEY=VALUE pairs to the process environment.
+func (c *Cmd) WithEnv(env ...string) *Cmd {
+	c.env = append(c.env, env...)
+	return c
+}
+
+// WithSecrets masks the given values whenever the command is printed.
+func (c *Cmd) WithSecrets(secrets ...string) *Cmd {
+	for _, s := range secrets {
+		if s != "" {
+			c.secrets = append(c.secrets, s)
+		}
+	}
+	return c
+}
+
+// ReadOnly marks a command that doesn't change anything. Dry runs still run it.
+func (c *Cmd) ReadOnly() *Cmd {
+	c.readOnly = true
+	return c
+}
+
+func (c *Cmd) Run() error                          { return runner.Run(c) }
+func (c *Cmd) Output() ([]byte, error)             { return runner.Output(c) }
+func (c *Cmd) CombinedOutput() ([]byte, error)     { return runner.CombinedOutput(c) }
+func do(description string, fn func() error) error { return runner.Do(description, fn) }
+
+// Argv returns the full argument list, including sudo.
+func (c *Cmd) Argv() []string {
+	if c.sudo {
+		return append([]string{"sudo", c.name}, c.args...)
+	}
+	return append([]string{c.name}, c.args...)
+}
+
+var secretEnvKey = regexp.MustCompile(`(?i)pass|secret|token`)
+
+// String renders the command for display with secrets masked.
+func (c *Cmd) String() string {
+	var parts []string
+	for _, e := range c.env {
+		parts = append(parts, shellQuote(c.mask(maskEnv(e))))
+	}
+	argv := c.Argv()
+	for i, arg := range argv {
+		if i > 0 && argv[i-1] == "-e" {
+			arg = maskEnv(arg)
+		}
+		parts = append(parts, shellQuote(c.mask(arg)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *Cmd) mask(s string) string {
+	for _, secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, "****")
+	}
+	return s
+}
+
+// maskEnv hides the value of KEY=VALUE pairs that look like credentials
+func maskEnv(e string) string {
+	key, _, found := strings.Cut(e, "=")
+	if found && secretEnvKey.MatchString(key) {
+		return key + "=****"
+	}
+	return e
+}
+
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_/.:=@%+,*-]+$`)
+
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ExecRunner runs commands for real.
+type ExecRunner struct{}
+
+func (ExecRunner) cmd(c *Cmd) *exec.Cmd {
+	argv := c.Argv()
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd
+}
+
+func (r ExecRunner) Run(c *Cmd) error {
+	return r.cmd(c).Run()
+}
+
+func (r ExecRunner) Output(c *Cmd) ([]byte, error) {
+	cmd := r.cmd(c)
+	cmd.Stdout = nil
+	return cmd.Output()
+}
+
+func (r ExecRunner) CombinedOutput(c *Cmd) ([]byte, error) {
+	cmd := r.cmd(c)
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	return cmd.CombinedOutput()
+}
+
+func (ExecRunner) Do(_ string, fn func() error) error {
+	return fn()
+}
+
+// DryRunner prints commands instead of running them. Read only commands
+// still run so actions can show what they would do.
+type DryRunner struct {
+	Out  io.Writer
+	exec ExecRunner
+}
+
+func (r DryRunner) print(s string) {
+	fmt.Fprintln(r.Out, "[dry-run] "+s)
+}
+
+func (r DryRunner) Run(c *Cmd) error {
+	if c.readOnly {
+		return r.exec.Run(c)
+	}
+	r.print(c.String())
+	return nil
+}
+
+func (r DryRunner) Output(c *Cmd) ([]byte, error) {
+	if c.readOnly {
+		return r.exec.Output(c)
+	}
+	r.print(c.String())
+	return nil, nil
+}
+
+func (r DryRunner) CombinedOutput(c *Cmd) ([]byte, error) {
+	if c.readOnly {
+		return r.exec.CombinedOutput(c)
+	}
+	r.print(c.String())
+	return nil, nil
+}
+
+func (r DryRunner) Do(description string, _ func() error) error {
+	r.print("# " + description)
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records commands instead of running them. A command prints
+// the output of the first key of outputs it contains, and commands that
+// contain fail fail. Do records its description without touching the disk.
+type fakeRunner struct {
+	commands []string
+	outputs  map[string]string
+	fail     string
+}
+
+func (r *fakeRunner) run(c *Cmd) ([]byte, error) {
+	line := strings.Join(c.Argv(), " ")
+	r.commands = append(r.commands, line)
+	if r.fail != "" && strings.Contains(line, r.fail) {
+		return nil, errors.New("exit status 1")
+	}
+	for key, output := range r.outputs {
+		if strings.Contains(line, key) {
+			return []byte(output), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRunner) Run(c *Cmd) error {
+	output, err := r.run(c)
+	if c.Stdout != nil {
+		c.Stdout.Write(output)
+	}
+	return err
+}
+
+func (r *fakeRunner) Output(c *Cmd) ([]byte, error)         { return r.run(c) }
+func (r *fakeRunner) CombinedOutput(c *Cmd) ([]byte, error) { return r.run(c) }
+
+func (r *fakeRunner) Do(description string, _ func() error) error {
+	r.commands = append(r.commands, "# "+description)
+	return nil
+}
+
+// ran reports whether a recorded command contains s.
+func (r *fakeRunner) ran(s string) bool {
+	for _, command := range r.commands {
+		if strings.Contains(command, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// assertRanInOrder checks that commands containing each of want ran, in
+// that order.
+func assertRanInOrder(t *testing.T, r *fakeRunner, want ...string) {
+	t.Helper()
+	i := 0
+	for _, command := range r.commands {
+		if i < len(want) && strings.Contains(command, want[i]) {
+			i++
+		}
+	}
+	if i < len(want) {
+		t.Errorf("no command with %q in order, ran:\n%s", want[i], strings.Join(r.commands, "\n"))
+	}
+}
+
+// useFakeRunner swaps the runner for a fake and runs the action as a
+// scripted subcommand with --yes. USER points home at a temporary folder.
+// The home folder is returned the way actions spell it, /home/../tmp/...
+func useFakeRunner(t *testing.T, r *fakeRunner) string {
+	t.Helper()
+	home := t.TempDir()
+	oldRunner, oldUser, oldScripted, oldYes := runner, USER, scripted, assumeYes
+	t.Cleanup(func() {
+		runner, USER, scripted, assumeYes = oldRunner, oldUser, oldScripted, oldYes
+	})
+	runner = r
+	// paths are built as /home/$USER
+	USER = ".." + home
+	scripted = true
+	assumeYes = true
+	return "/home/" + USER
+}
+
+// writeTestFile writes a file, creating its folder.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCmdString(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Cmd
+		want string
+	}{
+		{"plain", command("docker", "compose", "up", "-d"), "docker compose up -d"},
+		{"sudo", sudoCommand("rm", "-rf", "/home/me/sites/shop"), "sudo rm -rf /home/me/sites/shop"},
+		{"quoting", command("wp", "search-replace", "it's here", "a b"), `wp search-replace 'it'\''s here' 'a b'`},
+		{
+			"secret env",
+			command("mariadb").WithEnv("DB_NAME=shop", "DB_PASSWORD=hunter2", "API_TOKEN=abc"),
+			"DB_NAME=shop DB_PASSWORD=**** API_TOKEN=**** mariadb",
+		},
+		{
+			"secret -e argument",
+			command("docker", "exec", "-e", "WORDPRESS_DB_PASSWORD=hunter2", "-e", "DB_USER=u_shop", "mariadb"),
+			"docker exec -e WORDPRESS_DB_PASSWORD=**** -e DB_USER=u_shop mariadb",
+		},
+		{
+			"secret values",
+			command("ssh", "host", "echo hunter2").WithSecrets("hunter2", ""),
+			"ssh host 'echo ****'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDryRunner(t *testing.T) {
+	var out bytes.Buffer
+	r := DryRunner{Out: &out}
+
+	if err := r.Run(sudoCommand("rm", "-rf", "/tmp/nothing").WithEnv("DB_PASSWORD=hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := r.Output(command("false")); err != nil || output != nil {
+		t.Errorf("Output ran a command that changes things: %q, %v", output, err)
+	}
+	if err := r.Do("write /tmp/nothing", func() error {
+		t.Error("Do ran its change")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := "[dry-run] DB_PASSWORD=**** sudo rm -rf /tmp/nothing\n" +
+		"[dry-run] false\n" +
+		"[dry-run] # write /tmp/nothing\n"
+	if got := out.String(); got != want {
+		t.Errorf("printed\n%s\nwant\n%s", got, want)
+	}
+
+	// read only commands run for real and aren't printed
+	out.Reset()
+	output, err := r.Output(command("echo", "hello").ReadOnly())
+	if err != nil || string(output) != "hello\n" {
+		t.Errorf("got %q, %v, want the command's output", output, err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("printed a read only command: %s", out.String())
+	}
+}
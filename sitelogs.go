@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+)
+
+// container of the caddy reverse proxy that serves all sites
+const caddyContainer = "caddy"
+
+// lineFilter passes whole lines through keep, which can rewrite them, and
+// writes the lines it keeps to out.
+type lineFilter struct {
+	out  io.Writer
+	keep func(line string) (string, bool)
+	line []byte
+	kept int
+}
+
+func (f *lineFilter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if c != '\n' {
+			f.line = append(f.line, c)
+			continue
+		}
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (f *lineFilter) flush() error {
+	line := strings.TrimSuffix(string(f.line), "\r")
+	f.line = f.line[:0]
+	if line, ok := f.keep(line); ok {
+		f.kept++
+		_, err := fmt.Fprintln(f.out, line)
+		return err
+	}
+	return nil
+}
+
+// Close writes a last line that had no newline.
+func (f *lineFilter) Close() error {
+	if len(f.line) == 0 {
+		return nil
+	}
+	return f.flush()
+}
+
+// CaddyAccess is a request from caddy's JSON access log.
+type CaddyAccess struct {
+	Logger  string  `json:"logger"`
+	TS      float64 `json:"ts"`
+	Status  int     `json:"status"`
+	Size    int64   `json:"size"`
+	Elapsed float64 `json:"duration"`
+	Request struct {
+		RemoteIP string `json:"remote_ip"`
+		ClientIP string `json:"client_ip"`
+		Method   string `json:"method"`
+		Host     string `json:"host"`
+		URI      string `json:"uri"`
+	} `json:"request"`
+}
+
+// ParseCaddyAccess reads an access log line. Caddy's other log lines are
+// not access logs and give false.
+func ParseCaddyAccess(line string) (CaddyAccess, bool) {
+	var access CaddyAccess
+	if err := json.Unmarshal([]byte(line), &access); err != nil {
+		return access, false
+	}
+	return access, strings.HasPrefix(access.Logger, "http.log.access")
+}
+
+// Host returns the requested host without a port.
+func (a CaddyAccess) Host() string {
+	host, _, _ := strings.Cut(a.Request.Host, ":")
+	return strings.ToLower(host)
+}
+
+func (a CaddyAccess) String() string {
+	ip := a.Request.ClientIP
+	if ip == "" {
+		ip = a.Request.RemoteIP
+	}
+	ts := time.Unix(0, int64(a.TS*float64(time.Second)))
+	return fmt.Sprintf("%s %d %s %s%s %s %s %s", ts.Format("2006-01-02 15:04:05"), a.Status, a.Request.Method, a.Host(), a.Request.URI,
+		ip, FormatBytes(a.Size), time.Duration(a.Elapsed*float64(time.Second)).Round(time.Millisecond))
+}
+
+// matchesDomain reports whether a host is one of a site's caddy domains,
+// which can start with a *. wildcard.
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain, _, _ = strings.Cut(strings.ToLower(domain), ":")
+		if wildcard, found := strings.CutPrefix(domain, "*."); found {
+			if strings.HasSuffix(host, "."+wildcard) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// debug.log lines start with a timestamp like [17-Oct-2026 04:00:00 UTC]
+var debugLogTimeRe = regexp.MustCompile(`^\[(\d{2}-\w{3}-\d{4} \d{2}:\d{2}:\d{2} \w+)\]`)
+
+// ParseDebugLogTime reads the timestamp of a debug.log entry. Lines that
+// continue an entry, like stack traces, have none.
+func ParseDebugLogTime(line string) (time.Time, bool) {
+	match := debugLogTimeRe.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("02-Jan-2006 15:04:05 MST", match[1])
+	return t, err == nil
+}
+
+var siteLogsArgs = struct {
+	source  string
+	service string
+	since   string
+	tail    int
+	follow  bool
+	grep    string
+}{source: "containers", tail: 100}
+
+func siteLogsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&siteLogsArgs.source, "source", "containers", "containers, access (caddy access log) or debug (wp-content/debug.log)")
+	fs.StringVar(&siteLogsArgs.service, "service", "", "only show logs of this compose service")
+	fs.StringVar(&siteLogsArgs.since, "since", "", "only show lines from this window, like 1h or 7d")
+	fs.IntVar(&siteLogsArgs.tail, "tail", 100, "number of lines to show when --since isn't set, 0 for all")
+	fs.BoolVar(&siteLogsArgs.follow, "follow", false, "keep printing new lines")
+	fs.StringVar(&siteLogsArgs.grep, "grep", "", "only show lines matching this regular expression")
+}
+
+func siteLogs() error {
+	siteDir := sitePath(chosenSite)
+	compose, err := ReadComposeFile(siteDir + "/docker-compose.yml")
+	if err != nil {
+		return stepFailed("Read docker-compose.yml", err)
+	}
+
+	source := siteLogsArgs.source
+	service := siteLogsArgs.service
+	since := siteLogsArgs.since
+	pattern := siteLogsArgs.grep
+	follow := siteLogsArgs.follow
+
+	serviceOptions := []huh.Option[string]{huh.NewOption("All services", "")}
+	for _, name := range compose.Services() {
+		serviceOptions = append(serviceOptions, huh.NewOption(name, name))
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select log").
+				Options(
+					huh.NewOption("Containers", "containers"),
+					huh.NewOption("Caddy access log", "access"),
+					huh.NewOption("WordPress debug.log", "debug"),
+				).
+				Value(&source),
+		),
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select service").
+				Options(serviceOptions...).
+				Value(&service),
+		).WithHideFunc(func() bool {
+			return source != "containers"
+		}),
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select time window").
+				Options(
+					huh.NewOption(fmt.Sprintf("Last %d lines", siteLogsArgs.tail), ""),
+					huh.NewOption("Last hour", "1h"),
+					huh.NewOption("Last 24 hours", "24h"),
+					huh.NewOption("Last 7 days", "7d"),
+				).
+				Value(&since),
+
+			huh.NewInput().
+				Title("Filter lines").
+				Description("A regular expression, or empty for all lines.").
+				Validate(func(s string) error {
+					_, err := regexp.Compile(s)
+					return err
+				}).
+				Value(&pattern),
+
+			huh.NewConfirm().
+				Title("Follow new lines?").
+				Description("Press ctrl+c to stop.").
+				Value(&follow),
+		),
+	)
+	if err := prompt(form); err != nil {
+		return err
+	}
+
+	grep, err := regexp.Compile(pattern)
+	if err != nil {
+		return &UsageError{fmt.Sprintf("invalid --grep: %s", err)}
+	}
+	var from time.Time
+	if since != "" {
+		window, err := parseWindow(since)
+		if err != nil {
+			return &UsageError{err.Error() + ", use a duration like 1h or 7d"}
+		}
+		if window > 0 {
+			from = time.Now().Add(-window)
+		}
+	}
+	if service != "" && !slices.Contains(compose.Services(), service) {
+		return &UsageError{fmt.Sprintf("unknown service %q, use one of %s", service, strings.Join(compose.Services(), ", "))}
+	}
+
+	// a time window replaces the line count
+	tail := siteLogsArgs.tail
+	if !from.IsZero() {
+		tail = 0
+	}
+	var args []string
+	if tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(tail))
+	}
+	if !from.IsZero() {
+		args = append(args, "--since", strconv.FormatInt(from.Unix(), 10))
+	}
+	if follow {
+		args = append(args, "--follow")
+	}
+	keep := func(line string) (string, bool) {
+		return line, grep.MatchString(line)
+	}
+
+	var cmd *Cmd
+	switch source {
+	case "containers":
+		// docker compose -f "/home/$CUR_USER/sites/$sitename/docker-compose.yml" logs
+		if service != "" {
+			args = append(args, service)
+		}
+		cmd = command("docker", append([]string{"compose", "-f", siteDir + "/docker-compose.yml", "logs"}, args...)...)
+
+	case "access":
+		domains, _ := compose.Label("wordpress", "caddy")
+		if domains == "" {
+			return stepFailed("Read docker-compose.yml", fmt.Errorf("%s has no caddy domains", chosenSite))
+		}
+		cmd = command("docker", append(append([]string{"logs"}, args...), caddyContainer)...)
+		keep = func(line string) (string, bool) {
+			access, ok := ParseCaddyAccess(line)
+			if !ok || !matchesDomain(access.Host(), strings.Fields(domains)) {
+				return "", false
+			}
+			line = access.String()
+			return line, grep.MatchString(line)
+		}
+
+	case "debug":
+		debugLog := siteDir + "/wordpress/wp-content/debug.log"
+		if _, err := os.Stat(debugLog); errors.Is(err, os.ErrNotExist) {
+			printInBox("There is no debug.log yet.\n\nSet WP_DEBUG and WP_DEBUG_LOG to true in wp-config.php to write one.")
+			return nil
+		}
+		// tail has its own flags, --since is checked on each entry below
+		lines := "+1"
+		if tail > 0 {
+			lines = strconv.Itoa(tail)
+		}
+		tailArgs := []string{"-n", lines}
+		if follow {
+			tailArgs = append(tailArgs, "-F")
+		}
+		// stack traces belong to the entry above them
+		recent := from.IsZero()
+		cmd = command("tail", append(tailArgs, debugLog)...)
+		keep = func(line string) (string, bool) {
+			if t, ok := ParseDebugLogTime(line); ok {
+				recent = from.IsZero() || !t.Before(from)
+			}
+			return line, recent && grep.MatchString(line)
+		}
+
+	default:
+		return &UsageError{fmt.Sprintf("unknown --source %q, use containers, access or debug", source)}
+	}
+
+	filter := &lineFilter{out: os.Stdout, keep: keep}
+	cmd.Stdout = filter
+	// caddy logs to stderr
+	if source == "access" {
+		cmd.Stderr = filter
+	} else {
+		cmd.Stderr = os.Stderr
+	}
+	err = cmd.ReadOnly().RunStep("Read logs")
+	filter.Close()
+	if err != nil {
+		return err
+	}
+	if source == "access" && filter.kept == 0 && pattern == "" {
+		printInBox("No access log lines for " + chosenSite + ".\n\nCaddy only logs requests of sites with a log directive, like a caddy.log label.")
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+)
+
+// SiteInfo is the inventory entry for a site.
+type SiteInfo struct {
+	Name      string   `json:"name"`
+	Domains   []string `json:"domains"`
+	TLS       string   `json:"tls"`
+	PHP       string   `json:"php"`
+	Image     string   `json:"image"`
+	State     string   `json:"state"`
+	Database  string   `json:"database"`
+	DiskBytes int64    `json:"disk_bytes"`
+	Template  string   `json:"template"`
+}
+
+func sitePath(site string) string {
+	return "/home/" + USER + "/sites/" + site
+}
+
+// ComposeContainer is a container that belongs to a compose project.
+type ComposeContainer struct {
+	Name    string
+	Project string
+	Service string
+	State   string
+	// folder of the compose file the container was created from
+	WorkingDir string
+}
+
+// ListComposeContainers returns all containers, including stopped ones,
+// with their compose project and service labels.
+func ListComposeContainers() ([]ComposeContainer, error) {
+	output, err := command("docker", "ps", "-a", "--format", `{{.Names}}\t{{.Label "com.docker.compose.project"}}\t{{.Label "com.docker.compose.service"}}\t{{.State}}\t{{.Label "com.docker.compose.project.working_dir"}}`).ReadOnly().OutputStep("List containers")
+	if err != nil {
+		return nil, err
+	}
+	var containers []ComposeContainer
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		containers = append(containers, ComposeContainer{fields[0], fields[1], fields[2], fields[3], fields[4]})
+	}
+	return containers, nil
+}
+
+// Site returns the site folder the container was created from, or "" when
+// its compose file isn't in ~/sites. Compose lowercases and strips project
+// names, so they can't be compared with site names.
+func (c ComposeContainer) Site() string {
+	if c.WorkingDir == "" {
+		return ""
+	}
+	dir, site := filepath.Split(filepath.Clean(c.WorkingDir))
+	if filepath.Clean(dir) != "/home/"+USER+"/sites" {
+		return ""
+	}
+	return site
+}
+
+// GetSiteInfo collects the inventory for a site. containers should come from
+// ListComposeContainers.
+func GetSiteInfo(site string, containers []ComposeContainer) SiteInfo {
+	dir := sitePath(site)
+	info := SiteInfo{
+		Name:     site,
+		Domains:  []string{},
+		State:    "not created",
+		Template: ReadSiteTemplateVersion(dir),
+	}
+
+	if compose, err := ReadComposeFile(dir + "/docker-compose.yml"); err == nil {
+		if domains, ok := compose.Label("wordpress", "caddy"); ok {
+			info.Domains = strings.Fields(domains)
+		}
+		info.TLS = "acme"
+		if tls, ok := compose.Label("wordpress", "caddy.tls"); ok {
+			info.TLS = tls
+		}
+		info.Image = compose.Image("wordpress")
+		switch {
+		case strings.Contains(info.Image, "docker-wordpress-7"):
+			info.PHP = "7"
+		case strings.Contains(info.Image, "docker-wordpress-8"):
+			info.PHP = "8"
+		}
+	}
+
+	for _, container := range containers {
+		if container.Site() == site && container.Service == "wordpress" {
+			info.State = container.State
+		}
+	}
+
+	if values, err := ReadDefineValues(dir + "/wordpress/wp-config.php"); err == nil {
+		info.Database = values["DB_NAME"]
+	}
+
+	info.DiskBytes = DirectorySize(dir)
+	return info
+}
+
+// DirectorySize adds up the size of all files under dir, skipping anything
+// that can't be read.
+func DirectorySize(dir string) (size int64) {
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return
+}
+
+var listSitesArgs struct {
+	json bool
+}
+
+func listSitesFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&listSitesArgs.json, "json", false, "print as JSON")
+}
+
+func listSites() error {
+	sites := GetDirectoriesInPath("/home/" + USER + "/sites")
+	containers, err := ListComposeContainers()
+	if err != nil {
+		return err
+	}
+
+	inventory := make([]SiteInfo, 0, len(sites))
+	for _, site := range sites {
+		inventory = append(inventory, GetSiteInfo(site, containers))
+	}
+
+	if listSitesArgs.json {
+		return printJSON(inventory)
+	}
+
+	if len(inventory) == 0 {
+		printInBox("No sites found in /home/" + USER + "/sites")
+		return nil
+	}
+
+	stateStyle := func(state string) string {
+		color := "160"
+		switch state {
+		case "running":
+			color = "42"
+		case "restarting", "paused", "created":
+			color = "220"
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render(state)
+	}
+
+	rows := make([][]string, 0, len(inventory))
+	for _, site := range inventory {
+		rows = append(rows, []string{
+			site.Name,
+			strings.Join(site.Domains, "\n"),
+			orDash(site.TLS),
+			orDash(site.PHP),
+			stateStyle(site.State),
+			orDash(site.Database),
+			FormatBytes(site.DiskBytes),
+		})
+	}
+
+	fmt.Println(renderTable([]string{"Site", "Domains", "TLS", "PHP", "State", "Database", "Disk"}, rows))
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func renderTable(headers []string, rows [][]string) string {
+	return table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("63"))).
+		Headers(headers...).
+		Rows(rows...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == 0 {
+				return style.Bold(true).Foreground(lipgloss.Color("63"))
+			}
+			return style
+		}).
+		Render()
+}
+
+func printJSON(v any) error {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// SSHHost is a host alias from an ssh config with the settings ssh would
+// use to connect to it.
+type SSHHost struct {
+	Alias    string
+	HostName string
+	User     string
+	Port     string
+}
+
+// Label describes the host for a picker, like "web (deploy@1.2.3.4:2222)".
+func (h SSHHost) Label() string {
+	target := h.HostName
+	if target == "" {
+		target = h.Alias
+	}
+	if h.User != "" {
+		target = h.User + "@" + target
+	}
+	if h.Port != "" {
+		target += ":" + h.Port
+	}
+	if target == h.Alias {
+		return h.Alias
+	}
+	return h.Alias + " (" + target + ")"
+}
+
+// sshConfigReader reads config files and expands Include globs. Root's
+// config needs sudo to read.
+type sshConfigReader struct {
+	sudo bool
+}
+
+func (r sshConfigReader) read(path string) ([]byte, error) {
+	if r.sudo {
+		return sudoCommand("cat", path).ReadOnly().Output()
+	}
+	return os.ReadFile(path)
+}
+
+func (r sshConfigReader) glob(pattern string) ([]string, error) {
+	if !r.sudo {
+		return filepath.Glob(pattern)
+	}
+	// let the shell expand the pattern as root, printing only files that exist
+	output, err := sudoCommand("sh", "-c", `for f in `+globQuote(pattern)+`; do [ -f "$f" ] && printf '%s\n' "$f"; done; true`).ReadOnly().Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// globQuote shell quotes a path but leaves glob characters active
+func globQuote(pattern string) string {
+	var sb strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*', '?':
+			sb.WriteRune(r)
+		default:
+			sb.WriteString(shellQuote(string(r)))
+		}
+	}
+	return sb.String()
+}
+
+// sshConfigLine is a keyword and its arguments
+type sshConfigLine struct {
+	keyword string
+	args    []string
+}
+
+// splitSSHConfigLine splits a config line into its lower case keyword and
+// arguments. The keyword can be separated by whitespace or "=", and
+// arguments can be double quoted.
+func splitSSHConfigLine(line string) (sshConfigLine, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return sshConfigLine{}, false
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return sshConfigLine{keyword: strings.ToLower(line)}, true
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				args = append(args, rest[1:])
+				break
+			}
+			args = append(args, rest[1:end+1])
+			rest = strings.TrimLeft(rest[end+2:], " \t")
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			args = append(args, rest)
+			break
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return sshConfigLine{keyword: keyword, args: args}, true
+}
+
+// ssh gives up on Include loops at the same depth
+const maxSSHIncludeDepth = 16
+
+// loadSSHConfig reads a config file into lines, replacing Include lines with
+// the lines of the included files. Relative includes are looked up in the
+// folder of the top level config, as ssh does for ~/.ssh/config.
+func loadSSHConfig(r sshConfigReader, path, baseDir string, depth int) ([]sshConfigLine, error) {
+	if depth > maxSSHIncludeDepth {
+		return nil, fmt.Errorf("%s: too many nested includes", path)
+	}
+	content, err := r.read(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []sshConfigLine
+	for _, text := range strings.Split(string(content), "\n") {
+		line, ok := splitSSHConfigLine(text)
+		if !ok {
+			continue
+		}
+		if line.keyword != "include" {
+			lines = append(lines, line)
+			continue
+		}
+		for _, pattern := range line.args {
+			if strings.HasPrefix(pattern, "~/") {
+				pattern = filepath.Join(filepath.Dir(baseDir), pattern[2:])
+			} else if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(baseDir, pattern)
+			}
+			paths, err := r.glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, include := range paths {
+				included, err := loadSSHConfig(r, include, baseDir, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, included...)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// matchSSHPattern matches a host against an ssh pattern with * and ?
+func matchSSHPattern(pattern, host string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	matched, _ := regexp.MatchString("^"+expr+"$", host)
+	return matched
+}
+
+// matchSSHHost reports whether a Host line's patterns apply to alias. A
+// negated pattern that matches rules the host out.
+func matchSSHHost(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchSSHPattern(negated, alias) {
+				return false
+			}
+		} else if matchSSHPattern(pattern, alias) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// ParseSSHConfig returns the hosts that can be picked from an ssh config:
+// every alias on a Host line that isn't a wildcard or negated pattern.
+//
+// HostName, User and Port are resolved like ssh does, from the first
+// matching Host block that sets them. Match blocks other than "Match all"
+// depend on the connection, so they are skipped.
+func ParseSSHConfig(path string, sudo bool) ([]SSHHost, error) {
+	lines, err := loadSSHConfig(sshConfigReader{sudo: sudo}, path, filepath.Dir(path), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []SSHHost
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if line.keyword != "host" {
+			continue
+		}
+		for _, alias := range line.args {
+			if strings.ContainsAny(alias, "*?!") || seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			hosts = append(hosts, SSHHost{Alias: alias})
+		}
+	}
+
+	for i := range hosts {
+		host := &hosts[i]
+		// lines before the first Host or Match apply to every host
+		active := true
+		for _, line := range lines {
+			switch line.keyword {
+			case "host":
+				active = matchSSHHost(line.args, host.Alias)
+			case "match":
+				active = len(line.args) == 1 && strings.EqualFold(line.args[0], "all")
+			}
+			if !active || len(line.args) == 0 {
+				continue
+			}
+			// the first value wins
+			switch line.keyword {
+			case "hostname":
+				if host.HostName == "" {
+					host.HostName = strings.ReplaceAll(line.args[0], "%h", host.Alias)
+				}
+			case "user":
+				if host.User == "" {
+					host.User = line.args[0]
+				}
+			case "port":
+				if host.Port == "" {
+					host.Port = line.args[0]
+				}
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// GetHostsFromSSHConfig returns the hosts in an ssh config that can be
+// connected to by name.
+func GetHostsFromSSHConfig(configPath string, sudo bool) ([]SSHHost, error) {
+	return ParseSSHConfig(configPath, sudo)
+}
+
+// checkSSHHost makes sure a host given on the command line is one of the
+// configured aliases, so it can't be passed to ssh as an option.
+func checkSSHHost(hosts []SSHHost, alias string) error {
+	for _, host := range hosts {
+		if host.Alias == alias {
+			return nil
+		}
+	}
+	return &UsageError{fmt.Sprintf("unknown host %q, add it to /root/.ssh/config first", alias)}
+}
+
+// sshHostOptions lists hosts for a select, showing where each one points.
+func sshHostOptions(hosts []SSHHost) []huh.Option[string] {
+	options := make([]huh.Option[string], 0, len(hosts))
+	for _, host := range hosts {
+		options = append(options, huh.NewOption(host.Label(), host.Alias))
+	}
+	return options
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSSHConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// other files in the folder of the config
+		files map[string]string
+		want  []SSHHost
+	}{
+		{
+			name:   "host with settings",
+			config: "Host web\n  HostName 1.2.3.4\n  User deploy\n  Port 2222\n",
+			want:   []SSHHost{{Alias: "web", HostName: "1.2.3.4", User: "deploy", Port: "2222"}},
+		},
+		{
+			name:   "several aliases on one line",
+			config: "Host old old-server\n  HostName old.example.com\n",
+			want: []SSHHost{
+				{Alias: "old", HostName: "old.example.com"},
+				{Alias: "old-server", HostName: "old.example.com"},
+			},
+		},
+		{
+			name:   "wildcards and negations are not hosts",
+			config: "Host *.example.com !bad web\n  User admin\nHost *\n  Port 22\n",
+			want:   []SSHHost{{Alias: "web", User: "admin", Port: "22"}},
+		},
+		{
+			name:   "first value wins",
+			config: "Host web\n  User first\nHost *\n  User second\n  Port 22\n",
+			want:   []SSHHost{{Alias: "web", User: "first", Port: "22"}},
+		},
+		{
+			name:   "settings before any host apply to all",
+			config: "User everyone\n\nHost a\nHost b\n  User b-user\n",
+			want:   []SSHHost{{Alias: "a", User: "everyone"}, {Alias: "b", User: "everyone"}},
+		},
+		{
+			name:   "negated pattern rules a host out",
+			config: "Host web db\nHost * !db\n  User app\n",
+			want:   []SSHHost{{Alias: "web", User: "app"}, {Alias: "db"}},
+		},
+		{
+			name:   "match all applies, other matches don't",
+			config: "Host web\nMatch host web exec true\n  User skipped\nMatch all\n  User everyone\n",
+			want:   []SSHHost{{Alias: "web", User: "everyone"}},
+		},
+		{
+			name:   "equals sign, quotes, comments and case",
+			config: "# servers\nHOST=web\n  hostname=\"10.0.0.1\"\n  USER \"deploy\"\n",
+			want:   []SSHHost{{Alias: "web", HostName: "10.0.0.1", User: "deploy"}},
+		},
+		{
+			name:   "%h in hostname",
+			config: "Host web\n  HostName %h.example.com\n",
+			want:   []SSHHost{{Alias: "web", HostName: "web.example.com"}},
+		},
+		{
+			name:   "relative include",
+			config: "Include conf.d/*\nHost main\n",
+			files: map[string]string{
+				"conf.d/a": "Host a\n  HostName a.example.com\n",
+				"conf.d/b": "Host b\n",
+			},
+			want: []SSHHost{{Alias: "a", HostName: "a.example.com"}, {Alias: "b"}, {Alias: "main"}},
+		},
+		{
+			name:   "include with no matches",
+			config: "Include missing/*\nHost main\n",
+			want:   []SSHHost{{Alias: "main"}},
+		},
+		{
+			name:   "duplicate aliases",
+			config: "Host web\n  Port 1\nHost web\n  Port 2\n",
+			want:   []SSHHost{{Alias: "web", Port: "1"}},
+		},
+		{
+			name:   "empty",
+			config: "",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, filepath.Join(dir, "config"), tt.config)
+			for name, content := range tt.files {
+				writeTestFile(t, filepath.Join(dir, name), content)
+			}
+			got, err := ParseSSHConfig(filepath.Join(dir, "config"), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSSHConfigIncludeLoop(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config"), "Include config\n")
+	if _, err := ParseSSHConfig(filepath.Join(dir, "config"), false); err == nil {
+		t.Error("include loop was not detected")
+	}
+}
+
+func TestSSHHostLabel(t *testing.T) {
+	tests := []struct {
+		host SSHHost
+		want string
+	}{
+		{SSHHost{Alias: "web"}, "web"},
+		{SSHHost{Alias: "web", HostName: "1.2.3.4"}, "web (1.2.3.4)"},
+		{SSHHost{Alias: "web", User: "deploy", Port: "2222"}, "web (deploy@web:2222)"},
+	}
+	for _, tt := range tests {
+		if got := tt.host.Label(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// site templates shipped with the binary, copied from a commit of the
+// setup repo by templates/vendor.sh, which writes the commit to VERSION
+//
+//go:generate sh templates/vendor.sh $TEMPLATE_COMMIT
+//go:embed all:templates/wordpress
+var embeddedTemplates embed.FS
+
+const templateRepo = "https://raw.githubusercontent.com/BOOST-Creative/docker-server-setup-caddy"
+
+// files copied into every new site directory
+var templateFiles = []string{"docker-compose.yml", ".htninja", "redis.conf"}
+
+// file in the site directory that records which templates it was created from
+const templateVersionFile = ".template-version"
+
+// TemplateSet is a set of site template files and where they came from.
+type TemplateSet struct {
+	FS      fs.FS
+	Version string
+	cleanup func()
+}
+
+// Close removes any files downloaded for the template set.
+func (t *TemplateSet) Close() {
+	if t.cleanup != nil {
+		t.cleanup()
+	}
+}
+
+// LoadTemplates returns the template set for a --template-source value.
+//
+// source can be empty for the embedded templates, a local directory, or
+// git:<ref> to download the templates from a branch, tag or commit. When
+// checksumFile is set, downloaded templates must match the sha256sum
+// manifest it points to.
+func LoadTemplates(source, checksumFile string) (*TemplateSet, error) {
+	switch {
+	case source == "" || source == "embedded":
+		sub, err := fs.Sub(embeddedTemplates, "templates/wordpress")
+		if err != nil {
+			return nil, err
+		}
+		return &TemplateSet{FS: sub, Version: "embedded " + readTemplateVersion(sub)}, nil
+
+	case strings.HasPrefix(source, "git:"):
+		ref := strings.TrimPrefix(source, "git:")
+		if ref == "" {
+			return nil, fmt.Errorf("missing git ref in %q", source)
+		}
+		var checksums map[string]string
+		if checksumFile != "" {
+			manifest, err := os.ReadFile(checksumFile)
+			if err != nil {
+				return nil, err
+			}
+			checksums, err = ParseChecksums(string(manifest))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", checksumFile, err)
+			}
+			for _, name := range templateFiles {
+				if checksums[name] == "" {
+					return nil, fmt.Errorf("%s has no checksum for %s", checksumFile, name)
+				}
+			}
+		}
+		dir, err := os.MkdirTemp("", "boost-templates-")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range templateFiles {
+			err := DownloadFileWithChecksum(templateRepo+"/"+ref+"/wordpress/"+name, filepath.Join(dir, name), checksums[name])
+			if err != nil {
+				os.RemoveAll(dir)
+				return nil, fmt.Errorf("download %s at %s: %w", name, ref, err)
+			}
+		}
+		return &TemplateSet{
+			FS:      os.DirFS(dir),
+			Version: "git " + ref,
+			cleanup: func() { os.RemoveAll(dir) },
+		}, nil
+
+	default:
+		dir, err := filepath.Abs(source)
+		if err != nil {
+			return nil, err
+		}
+		// accept a checkout of the setup repo as well as the wordpress folder itself
+		if info, err := os.Stat(filepath.Join(dir, "wordpress")); err == nil && info.IsDir() {
+			dir = filepath.Join(dir, "wordpress")
+		}
+		for _, name := range templateFiles {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				return nil, fmt.Errorf("template source %s: %w", dir, err)
+			}
+		}
+		set := &TemplateSet{FS: os.DirFS(dir), Version: "dir " + dir}
+		if version := readTemplateVersion(set.FS); version != "unknown" {
+			set.Version += " " + version
+		}
+		return set, nil
+	}
+}
+
+func readTemplateVersion(fsys fs.FS) string {
+	version, err := fs.ReadFile(fsys, "VERSION")
+	if err != nil || len(strings.TrimSpace(string(version))) == 0 {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(version))
+}
+
+// ReadSiteTemplateVersion returns the template version recorded for a site.
+// Sites created before versions were recorded return "unknown".
+func ReadSiteTemplateVersion(siteDir string) string {
+	version, err := os.ReadFile(filepath.Join(siteDir, templateVersionFile))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(version))
+}
@@ -0,0 +1,32 @@
+#!/bin/sh
+# Copies the site templates byte for byte from a commit of
+# BOOST-Creative/docker-server-setup-caddy and records the commit in
+# wordpress/VERSION. Run it through go generate:
+#
+#   TEMPLATE_COMMIT=<full sha> go generate ./...
+set -eu
+
+commit=${1:-}
+case $commit in
+*[!0-9a-f]* | "")
+	echo "usage: vendor.sh <40 character commit sha>" >&2
+	exit 2
+	;;
+esac
+if [ ${#commit} -ne 40 ]; then
+	echo "usage: vendor.sh <40 character commit sha>" >&2
+	exit 2
+fi
+
+repo=https://raw.githubusercontent.com/BOOST-Creative/docker-server-setup-caddy
+dir=$(dirname "$0")/wordpress
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+for name in docker-compose.yml .htninja redis.conf; do
+	curl -fsSL -o "$tmp/$name" "$repo/$commit/wordpress/$name"
+done
+for name in docker-compose.yml .htninja redis.conf; do
+	mv "$tmp/$name" "$dir/$name"
+done
+echo "$commit" >"$dir/VERSION"
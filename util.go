@@ -3,26 +3,29 @@ package main
 import (
 	"bufio"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/charmbracelet/huh/spinner"
 	"github.com/rhysd/go-github-selfupdate/selfupdate"
 )
 
-// Check if new version is available and update + exit if it is
-func CheckForUpdate() {
+// Check if new version is available and update if it is. Returns errUpdated
+// after an update so the old binary exits.
+func CheckForUpdate() error {
 	var latest *selfupdate.Release
 	var found bool
 	var err error
@@ -30,25 +33,30 @@ func CheckForUpdate() {
 	spinner.New().Title("Checking for update...").Action(func() {
 		latest, found, err = selfupdate.DetectLatest("BOOST-Creative/boost-server-cli")
 	}).Run()
-	checkError(err, "Failed to check for updates.")
+	if err != nil {
+		return stepFailed("Check for updates", err)
+	}
 
 	if !found || latest.Version.LTE(currentVersion) {
-		return
+		return nil
 	}
 
 	printInBox(fmt.Sprintf("Update available: %s -> %s", VERSION, latest.Version))
 
-	var binaryPath string
 	spinner.New().Title(fmt.Sprintf("Updating to %s...", latest.Version)).Action(func() {
+		var binaryPath string
 		binaryPath, err = os.Executable()
-		checkError(err, "Could not locate executable path")
+		if err != nil {
+			err = fmt.Errorf("could not locate executable path: %w", err)
+			return
+		}
 		err = selfupdate.UpdateTo(latest.AssetURL, binaryPath)
 	}).Run()
 	if err != nil {
-		checkError(err, "Error occurred while updating binary:\n\n"+err.Error()+"\n\nIf the error is permission based, try running with sudo.")
+		return stepFailed("Update binary", fmt.Errorf("%w\n\nIf the error is permission based, try running with sudo.", err))
 	}
 	printInBox(fmt.Sprintf("Successfully updated: %s -> %s\n\nRelease note:\n%s", VERSION, latest.Version, strings.TrimSpace(latest.ReleaseNotes)))
-	os.Exit(0)
+	return errUpdated
 }
 
 // GetDirectoriesInPath retrieves the list of directories in the specified path.
@@ -139,28 +147,85 @@ func AppendToFile(fileName, content string) error {
 	return nil
 }
 
+// timeout for a single file download
+const downloadTimeout = 30 * time.Second
+
+// DownloadFile downloads url to destination. See DownloadFileWithChecksum.
 func DownloadFile(url, destination string) error {
-	resp, err := http.Get(url)
+	return DownloadFileWithChecksum(url, destination, "")
+}
+
+// DownloadFileWithChecksum downloads url to destination.
+//
+// Responses other than 2xx are rejected. The file is written to a temporary
+// file next to destination and renamed into place once complete, so a failed
+// download never leaves a partial file. If sha256sum is not empty the
+// download must match it.
+func DownloadFileWithChecksum(url, destination, sha256sum string) error {
+	client := http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	// Create the output file
-	out, err := os.Create(destination)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	// Create a temporary file in the same directory so rename is atomic
+	out, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(out.Name())
 	defer out.Close()
 
-	// Write the contents to the file
-	_, err = io.Copy(out, resp.Body)
+	// Write the contents to the file while hashing them
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), resp.Body)
 	if err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+
+	if sha256sum != "" {
+		actual := hex.EncodeToString(hash.Sum(nil))
+		if !strings.EqualFold(actual, sha256sum) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, sha256sum, actual)
+		}
+	}
+
+	if err := out.Chmod(0644); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
 		return err
 	}
 
-	// fmt.Printf("File downloaded to: %s\n", destination)
-	return nil
+	return os.Rename(out.Name(), destination)
+}
+
+// ParseChecksums parses a manifest in the format written by sha256sum and
+// returns the checksum for each file name.
+func ParseChecksums(manifest string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	for i, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid checksum on line %d: %q", i+1, line)
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid checksum on line %d: %q", i+1, line)
+		}
+		// sha256sum marks binary mode with a leading asterisk
+		name := filepath.Base(strings.TrimPrefix(fields[1], "*"))
+		checksums[name] = strings.ToLower(fields[0])
+	}
+	return checksums, nil
 }
 
 func ReplaceTextInFile(filePath, oldText, newText string) error {
@@ -182,32 +247,6 @@ func ReplaceTextInFile(filePath, oldText, newText string) error {
 	return nil
 }
 
-func GetHostsFromSSHConfig(configPath string, sudo bool) ([]string, error) {
-	var content []byte
-	var err error
-	if sudo {
-		content, err = exec.Command("sudo", "cat", configPath).Output()
-	} else {
-		content, err = os.ReadFile(configPath)
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	// Define a regular expression to match Host entries in the SSH config file
-	re := regexp.MustCompile(`Host\s([a-zA-Z0-9\.\-]+)`)
-	var hosts []string
-
-	// Search for matches in the content
-	matches := re.FindAllStringSubmatch(string(content), -1)
-
-	for _, match := range matches {
-		hosts = append(hosts, match[1])
-	}
-
-	return hosts, nil
-}
-
 // finds the last modified file with the specified extension in the given directory.
 func FindLastModifiedFile(dirPath string, ext string) (fs.FileInfo, error) {
 	files, err := os.ReadDir(dirPath)
@@ -237,6 +276,28 @@ func FindLastModifiedFile(dirPath string, ext string) (fs.FileInfo, error) {
 	return matchedFiles[0], nil
 }
 
+// Regular expression to match any define variation
+var defineRe = regexp.MustCompile(`define\s*\(\s*['"](?P<key>[^'\"]+)['"]\s*,\s*['"](?P<value>[^'\"]+)['"]\s*\);`)
+
+// read constant values from a php file
+func ReadDefineValues(filePath string) (map[string]string, error) {
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDefineValues(string(fileData)), nil
+}
+
+// read constant values from php source
+func ParseDefineValues(content string) map[string]string {
+	values := make(map[string]string)
+	for _, match := range defineRe.FindAllStringSubmatch(content, -1) {
+		values[match[1]] = match[2]
+	}
+	return values
+}
+
 // update constant values in a php file
 func UpdateDefineValues(filePath string, updates map[string]string) error {
 	fileData, err := os.ReadFile(filePath)
@@ -245,8 +306,7 @@ func UpdateDefineValues(filePath string, updates map[string]string) error {
 		return err
 	}
 
-	// Regular expression to match any define variation
-	re := regexp.MustCompile(`define\s*\(\s*['"](?P<key>[^'\"]+)['"]\s*,\s*['"](?P<value>[^'\"]+)['"]\s*\);`)
+	re := defineRe
 
 	// Replace all matches and create new data
 	newData := re.ReplaceAllStringFunc(string(fileData), func(match string) string {
@@ -262,32 +322,80 @@ func UpdateDefineValues(filePath string, updates map[string]string) error {
 	})
 
 	// store current permission
-	cmd := exec.Command("stat", "-c", "%a", filePath)
-	out, err := cmd.Output()
+	out, err := command("stat", "-c", "%a", filePath).ReadOnly().Output()
 	if err != nil {
 		return fmt.Errorf("error getting permission: %w", err)
 	}
 	perm := strings.TrimSpace(string(out))
 
 	// set write permission with sudo
-	cmd = exec.Command("sudo", "chmod", "666", filePath)
-	err = cmd.Run()
+	err = sudoCommand("chmod", "666", filePath).Run()
 	if err != nil {
 		return fmt.Errorf("error setting write permission: %w", err)
 	}
 
 	// Write back the modified data to the file
-	err = os.WriteFile(filePath, []byte(newData), 0644)
+	err = do("update define values in "+filePath, func() error {
+		return os.WriteFile(filePath, []byte(newData), 0644)
+	})
 	if err != nil {
 		return err
 	}
 
 	// restore permission
-	cmd = exec.Command("sudo", "chmod", perm, filePath)
-	err = cmd.Run()
+	err = sudoCommand("chmod", perm, filePath).Run()
 	if err != nil {
 		return fmt.Errorf("error restoring permission: %w", err)
 	}
 
 	return nil
 }
+
+// sudoWriteFile replaces the content of a file that belongs to root. An
+// existing file keeps its owner and permissions.
+func sudoWriteFile(path, content, step string) error {
+	cmd := sudoCommand("tee", path)
+	cmd.Stdin = strings.NewReader(content)
+	_, err := cmd.Step(step)
+	return err
+}
+
+var siteNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateSiteName checks the name of a new site. Site names become
+// folder names under ~/sites and compose project names, so they are kept to
+// what docker compose uses as is: lowercase letters, digits, - and _.
+func ValidateSiteName(site string) error {
+	if site == "" {
+		return errors.New("site name cannot be empty")
+	}
+	if !siteNameRe.MatchString(site) {
+		return fmt.Errorf("invalid site name %q: use lowercase letters, digits, - and _, starting with a letter or digit", site)
+	}
+	return nil
+}
+
+// SiteExists reports whether a site directory exists in ~/sites.
+func SiteExists(site string) bool {
+	if site == "" || strings.ContainsAny(site, "/\\") || site[0] == '.' {
+		return false
+	}
+	info, err := os.Stat("/home/" + USER + "/sites/" + site)
+	return err == nil && info.IsDir()
+}
+
+// FormatBytes formats a size in bytes with a binary unit, e.g. 1.50 GB.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFileWithChecksum(t *testing.T) {
+	body := "services: {}\n"
+	sum := sha256.Sum256([]byte(body))
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/broken":
+			http.Error(w, "upstream down", http.StatusBadGateway)
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		checksum string
+		wantErr  bool
+	}{
+		{"no checksum", "/file", "", false},
+		{"matching checksum", "/file", checksum, false},
+		{"checksum in upper case", "/file", strings.ToUpper(checksum), false},
+		{"not found", "/missing", "", true},
+		{"server error", "/broken", "", true},
+		{"checksum mismatch", "/file", "0000000000000000000000000000000000000000000000000000000000000000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			destination := filepath.Join(dir, "docker-compose.yml")
+			writeTestFile(t, destination, "old\n")
+
+			err := DownloadFileWithChecksum(server.URL+tt.path, destination, tt.checksum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			want := body
+			if tt.wantErr {
+				want = "old\n"
+			}
+			got, err := os.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("destination has %q, want %q", got, want)
+			}
+			// the temporary file is always cleaned up
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("left files behind: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+)
+
+// fail2banDataPath is the data folder of the fail2ban container, which it
+// sees as /data.
+func fail2banDataPath() string {
+	return "/home/" + USER + "/server/fail2ban/data"
+}
+
+func jailLocalPath() string {
+	return fail2banDataPath() + "/jail.d/jail.local"
+}
+
+var (
+	iniSectionRe = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+	ignoreIPRe   = regexp.MustCompile(`^ignoreip\s*[=:]\s*(.*)$`)
+)
+
+// JailLocal is jail.local with the ignoreip setting of its [DEFAULT]
+// section picked out. Everything else is written back as it was read.
+type JailLocal struct {
+	lines []string
+	// lines[start:end] hold the setting, start is -1 when there is none
+	start, end int
+	IgnoreIP   []string
+}
+
+// ParseJailLocal reads ignoreip from the [DEFAULT] section, including
+// indented continuation lines. Entries are separated by spaces or commas.
+func ParseJailLocal(content string) *JailLocal {
+	j := &JailLocal{lines: strings.Split(content, "\n"), start: -1}
+	section := ""
+	for i := 0; i < len(j.lines); i++ {
+		line := j.lines[i]
+		if match := iniSectionRe.FindStringSubmatch(line); match != nil {
+			section = match[1]
+			continue
+		}
+		match := ignoreIPRe.FindStringSubmatch(line)
+		if section != "DEFAULT" || match == nil {
+			continue
+		}
+		values := []string{match[1]}
+		j.start, j.end = i, i+1
+		for j.end < len(j.lines) {
+			next := j.lines[j.end]
+			if strings.TrimSpace(next) == "" || (next[0] != ' ' && next[0] != '\t') {
+				break
+			}
+			values = append(values, next)
+			j.end++
+		}
+		j.IgnoreIP = splitIgnoreIP(strings.Join(values, " "))
+		break
+	}
+	return j
+}
+
+// splitIgnoreIP splits an ignoreip value, dropping an inline comment.
+func splitIgnoreIP(value string) []string {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		if strings.HasPrefix(entry, "#") || strings.HasPrefix(entry, ";") {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// String returns the file with the current IgnoreIP entries.
+func (j *JailLocal) String() string {
+	setting := "ignoreip = " + strings.Join(j.IgnoreIP, " ")
+	if j.start >= 0 {
+		lines := slices.Concat(j.lines[:j.start], []string{setting}, j.lines[j.end:])
+		return strings.Join(lines, "\n")
+	}
+	for i, line := range j.lines {
+		if match := iniSectionRe.FindStringSubmatch(line); match != nil && match[1] == "DEFAULT" {
+			return strings.Join(slices.Insert(slices.Clone(j.lines), i+1, setting), "\n")
+		}
+	}
+	return "[DEFAULT]\n" + setting + "\n\n" + strings.Join(j.lines, "\n")
+}
+
+// HasSection reports whether the file has a [name] section.
+func (j *JailLocal) HasSection(name string) bool {
+	for _, line := range j.lines {
+		if match := iniSectionRe.FindStringSubmatch(line); match != nil && match[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSection appends a section to the end of the file.
+func (j *JailLocal) AddSection(section string) {
+	for len(j.lines) > 0 && strings.TrimSpace(j.lines[len(j.lines)-1]) == "" {
+		j.lines = j.lines[:len(j.lines)-1]
+	}
+	j.lines = append(j.lines, "")
+	j.lines = append(j.lines, strings.Split(strings.TrimRight(section, "\n"), "\n")...)
+	j.lines = append(j.lines, "")
+}
+
+// whitelistNetwork reads an IP address or CIDR range as a network, a
+// single address being a /32 or /128. Hostnames give nil.
+func whitelistNetwork(entry string) *net.IPNet {
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network
+	}
+	return nil
+}
+
+// whitelistKey normalizes an entry so the same address written two ways,
+// like 1.2.3.4 and 1.2.3.4/32, is found as a duplicate.
+func whitelistKey(entry string) string {
+	if network := whitelistNetwork(entry); network != nil {
+		return network.String()
+	}
+	return entry
+}
+
+// ValidateAddress checks that an entry is an IP address or a CIDR
+// range.
+func ValidateAddress(entry string) error {
+	if net.ParseIP(entry) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return nil
+	}
+	return fmt.Errorf("%q is not an IP address or CIDR range", entry)
+}
+
+// Covering returns the entry that already whitelists an IP or range, or ""
+// when none does.
+func (j *JailLocal) Covering(entry string) string {
+	network := whitelistNetwork(entry)
+	for _, existing := range j.IgnoreIP {
+		if whitelistKey(existing) == whitelistKey(entry) {
+			return existing
+		}
+		covering := whitelistNetwork(existing)
+		if network == nil || covering == nil {
+			continue
+		}
+		ones, bits := network.Mask.Size()
+		coveringOnes, coveringBits := covering.Mask.Size()
+		if bits == coveringBits && coveringOnes <= ones && covering.Contains(network.IP) {
+			return existing
+		}
+	}
+	return ""
+}
+
+// Remove drops the entries matching any of the given ones and returns
+// the entries it dropped.
+func (j *JailLocal) Remove(entries ...string) []string {
+	keys := make(map[string]bool)
+	for _, entry := range entries {
+		keys[whitelistKey(entry)] = true
+	}
+	var removed []string
+	j.IgnoreIP = slices.DeleteFunc(j.IgnoreIP, func(existing string) bool {
+		if keys[whitelistKey(existing)] {
+			removed = append(removed, existing)
+			return true
+		}
+		return false
+	})
+	return removed
+}
+
+// ReadJailLocal reads jail.local, which belongs to root.
+func ReadJailLocal() (*JailLocal, error) {
+	output, err := sudoCommand("cat", jailLocalPath()).ReadOnly().OutputStep("Read jail.local")
+	if err != nil {
+		return nil, err
+	}
+	return ParseJailLocal(string(output)), nil
+}
+
+// updateJailLocal backs up jail.local next to itself and writes the new
+// content. The backup is put back on rollback.
+func updateJailLocal(undo *undoStack, j *JailLocal) error {
+	path := jailLocalPath()
+	backup := path + ".bak-" + time.Now().Format(backupTimeLayout)
+	_, err := sudoCommand("cp", "-p", path, backup).Step("Back up jail.local")
+	if err != nil {
+		return err
+	}
+	undo.push("Restored jail.local from "+backup, func() error {
+		_, err := sudoCommand("cp", backup, path).Step("Restore jail.local")
+		return err
+	})
+	return sudoWriteFile(path, j.String(), "Write jail.local")
+}
+
+// writeJailLocal updates jail.local and reloads fail2ban.
+func writeJailLocal(j *JailLocal) error {
+	var undo undoStack
+	err := spin("Updating whitelist...", func() error {
+		if err := updateJailLocal(&undo, j); err != nil {
+			return err
+		}
+		_, err := fail2banClient("reload").Step("Reload fail2ban")
+		return err
+	})
+	if err != nil {
+		return undo.rollback(err)
+	}
+	return nil
+}
+
+var listWhitelistArgs struct {
+	json bool
+}
+
+func listWhitelistFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&listWhitelistArgs.json, "json", false, "print as JSON")
+}
+
+func listWhitelist() error {
+	if err := getSudo(); err != nil {
+		return err
+	}
+	j, err := ReadJailLocal()
+	if err != nil {
+		return err
+	}
+
+	if listWhitelistArgs.json {
+		return printJSON(append([]string{}, j.IgnoreIP...))
+	}
+	if len(j.IgnoreIP) == 0 {
+		printInBox("No IPs are whitelisted.")
+		return nil
+	}
+
+	rows := make([][]string, 0, len(j.IgnoreIP))
+	for _, entry := range j.IgnoreIP {
+		kind := "IP"
+		switch {
+		case strings.Contains(entry, "/"):
+			kind = "range"
+		case net.ParseIP(entry) == nil:
+			kind = "host"
+		}
+		rows = append(rows, []string{entry, kind})
+	}
+	fmt.Println(renderTable([]string{"Whitelisted", "Type"}, rows))
+	return nil
+}
+
+var whitelistIpArgs struct {
+	ip string
+}
+
+func whitelistIpFlags(fs *flag.FlagSet) {
+	fs.StringVar(&whitelistIpArgs.ip, "ip", "", "IP addresses or CIDR ranges to whitelist, separated by spaces")
+}
+
+func whitelistIp() error {
+	ip := whitelistIpArgs.ip
+	err := prompt(huh.NewInput().
+		Title("Enter IP to whitelist").
+		Description("IP addresses or CIDR ranges like 203.0.113.0/24, separated by spaces.").
+		Validate(func(s string) error {
+			if strings.TrimSpace(s) == "" {
+				return fmt.Errorf("IP address cannot be empty")
+			}
+			for _, entry := range strings.Fields(s) {
+				if err := ValidateAddress(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Value(&ip))
+	if err != nil {
+		return err
+	}
+
+	entries := strings.Fields(ip)
+	if len(entries) == 0 {
+		return missing("ip")
+	}
+	for _, entry := range entries {
+		if err := ValidateAddress(entry); err != nil {
+			return &UsageError{err.Error()}
+		}
+	}
+
+	if err := getSudo(); err != nil {
+		return err
+	}
+	j, err := ReadJailLocal()
+	if err != nil {
+		return err
+	}
+
+	var added, skipped []string
+	for _, entry := range entries {
+		if existing := j.Covering(entry); existing != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (already covered by %s)", entry, existing))
+			continue
+		}
+		j.IgnoreIP = append(j.IgnoreIP, entry)
+		added = append(added, entry)
+	}
+	if len(added) == 0 {
+		printInBox("Nothing to add:\n" + strings.Join(skipped, "\n"))
+		return nil
+	}
+
+	if err := writeJailLocal(j); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Whitelisted %s.", strings.Join(added, ", "))
+	if len(skipped) > 0 {
+		message += "\n\nSkipped:\n" + strings.Join(skipped, "\n") + "\n\nHave a super day!"
+	} else {
+		message += " Have a super day!"
+	}
+	printInBox(message)
+	return nil
+}
+
+var unwhitelistIpArgs struct {
+	ip string
+}
+
+func unwhitelistIpFlags(fs *flag.FlagSet) {
+	fs.StringVar(&unwhitelistIpArgs.ip, "ip", "", "entries to remove from the whitelist, separated by spaces")
+}
+
+func unwhitelistIp() error {
+	if err := getSudo(); err != nil {
+		return err
+	}
+	j, err := ReadJailLocal()
+	if err != nil {
+		return err
+	}
+	if len(j.IgnoreIP) == 0 {
+		printInBox("No IPs are whitelisted.")
+		return nil
+	}
+
+	selected := strings.Fields(unwhitelistIpArgs.ip)
+	options := make([]huh.Option[string], 0, len(j.IgnoreIP))
+	for _, entry := range j.IgnoreIP {
+		options = append(options, huh.NewOption(entry, entry))
+	}
+	err = prompt(huh.NewMultiSelect[string]().
+		Title("Select entries to remove from the whitelist").
+		Options(options...).
+		Value(&selected))
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		return missing("ip")
+	}
+
+	removed := j.Remove(selected...)
+	if len(removed) == 0 {
+		return &UsageError{fmt.Sprintf("%s is not whitelisted", strings.Join(selected, ", "))}
+	}
+
+	confirmed := true
+	confirm(fmt.Sprintf("Remove %s from the whitelist?", strings.Join(removed, ", ")), "fail2ban can ban these addresses again.", &confirmed)
+	if !confirmed {
+		return declined()
+	}
+
+	if err := writeJailLocal(j); err != nil {
+		return err
+	}
+	printInBox(fmt.Sprintf("Removed %s from the whitelist. Have a vigilant day!", strings.Join(removed, ", ")))
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJailLocal(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "spaces",
+			content: "[DEFAULT]\nignoreip = 127.0.0.1/8 ::1 10.0.0.0/8\nbantime = 1h\n",
+			want:    []string{"127.0.0.1/8", "::1", "10.0.0.0/8"},
+		},
+		{
+			name:    "commas and colon",
+			content: "[DEFAULT]\nignoreip: 127.0.0.1/8,::1, 1.2.3.4\n",
+			want:    []string{"127.0.0.1/8", "::1", "1.2.3.4"},
+		},
+		{
+			name:    "continuation lines",
+			content: "[DEFAULT]\nignoreip = 127.0.0.1/8\n    1.2.3.4\n\t5.6.7.8\nbantime = 1h\n",
+			want:    []string{"127.0.0.1/8", "1.2.3.4", "5.6.7.8"},
+		},
+		{
+			name:    "inline comment",
+			content: "[DEFAULT]\nignoreip = 1.2.3.4 # office\n",
+			want:    []string{"1.2.3.4"},
+		},
+		{
+			name:    "only the DEFAULT section counts",
+			content: "[sshd]\nignoreip = 9.9.9.9\n\n[DEFAULT]\nignoreip = 1.2.3.4\n",
+			want:    []string{"1.2.3.4"},
+		},
+		{
+			name:    "no setting",
+			content: "[DEFAULT]\nbantime = 1h\n",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := ParseJailLocal(tt.content)
+			if !reflect.DeepEqual(j.IgnoreIP, tt.want) {
+				t.Errorf("got %q, want %q", j.IgnoreIP, tt.want)
+			}
+		})
+	}
+}
+
+func TestJailLocalString(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		add     string
+		want    string
+	}{
+		{
+			name:    "replaces the setting and its continuation lines",
+			content: "[DEFAULT]\nignoreip = 127.0.0.1/8\n    1.2.3.4\nbantime = 1h\n\n[sshd]\nignoreip = 9.9.9.9\n",
+			add:     "5.6.7.8",
+			want:    "[DEFAULT]\nignoreip = 127.0.0.1/8 1.2.3.4 5.6.7.8\nbantime = 1h\n\n[sshd]\nignoreip = 9.9.9.9\n",
+		},
+		{
+			name:    "adds the setting to DEFAULT",
+			content: "# local settings\n[DEFAULT]\nbantime = 1h\n",
+			add:     "1.2.3.4",
+			want:    "# local settings\n[DEFAULT]\nignoreip = 1.2.3.4\nbantime = 1h\n",
+		},
+		{
+			name:    "adds a DEFAULT section",
+			content: "[sshd]\nenabled = true\n",
+			add:     "1.2.3.4",
+			want:    "[DEFAULT]\nignoreip = 1.2.3.4\n\n[sshd]\nenabled = true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := ParseJailLocal(tt.content)
+			j.IgnoreIP = append(j.IgnoreIP, tt.add)
+			if got := j.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJailLocalCovering(t *testing.T) {
+	j := ParseJailLocal("[DEFAULT]\nignoreip = 127.0.0.1/8 ::1 10.0.0.0/8 203.0.113.7 office.example.com 2001:db8::/32\n")
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{"127.0.0.1", "127.0.0.1/8"},
+		{"10.1.2.3", "10.0.0.0/8"},
+		{"10.1.0.0/16", "10.0.0.0/8"},
+		{"203.0.113.7", "203.0.113.7"},
+		{"203.0.113.7/32", "203.0.113.7"},
+		{"::1", "::1"},
+		{"2001:db8::1", "2001:db8::/32"},
+		{"office.example.com", "office.example.com"},
+		// a wider range isn't covered by a narrower one
+		{"10.0.0.0/7", ""},
+		{"203.0.113.0/24", ""},
+		{"198.51.100.1", ""},
+		{"2001:db9::1", ""},
+		{"home.example.com", ""},
+	}
+	for _, tt := range tests {
+		if got := j.Covering(tt.entry); got != tt.want {
+			t.Errorf("Covering(%q) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestJailLocalRemove(t *testing.T) {
+	j := ParseJailLocal("[DEFAULT]\nignoreip = 127.0.0.1/8 1.2.3.4/32 5.6.7.8\n")
+	removed := j.Remove("1.2.3.4", "9.9.9.9")
+	if want := []string{"1.2.3.4/32"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %q, want %q", removed, want)
+	}
+	if want := []string{"127.0.0.1/8", "5.6.7.8"}; !reflect.DeepEqual(j.IgnoreIP, want) {
+		t.Errorf("left %q, want %q", j.IgnoreIP, want)
+	}
+}